@@ -0,0 +1,309 @@
+package ginmon
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Error types of ClientEndpointData.Errors.
+const (
+	ErrorTimeout           = "timeout"
+	ErrorCanceled          = "canceled"
+	ErrorDNS               = "dns"
+	ErrorConnectionRefused = "connection_refused"
+	ErrorConnectionReset   = "connection_reset"
+	ErrorTLS               = "tls"
+	ErrorOther             = "other"
+)
+
+// Phases of ClientEndpointData.Phases, recorded if enabled by
+// EnableTrace.
+const (
+	PhaseDNS     = "dns"
+	PhaseConnect = "connect"
+	PhaseTLS     = "tls"
+	PhaseTTFB    = "ttfb"
+)
+
+// ClientEndpointData is the calculated data of outgoing requests with
+// the same method and host. Latency is measured in nanoseconds until
+// the response headers are received. Codes counts responses by status
+// code, Errors counts requests without response by error type.
+type ClientEndpointData struct {
+	Count   int                           `json:"count"`
+	Codes   map[int]int                   `json:"codes"`
+	Errors  map[string]int                `json:"errors"`
+	Latency GenericChannelData            `json:"latency"`
+	Phases  map[string]GenericChannelData `json:"phases,omitempty"`
+}
+
+// ClientStats are the calculated data of all outgoing requests by
+// "METHOD host".
+type ClientStats struct {
+	Endpoints     map[string]ClientEndpointData `json:"endpoints"`
+	WindowSeconds float64                       `json:"window_seconds"`
+	Timestamp     time.Time                     `json:"timestamp"`
+}
+
+// clientWindow collects the requests of one endpoint in a time frame.
+type clientWindow struct {
+	codes     map[int]int
+	errors    map[string]int
+	latencies []float64
+	phases    map[string][]float64
+}
+
+// ClientAspect records outgoing HTTP requests of the http.RoundTripper
+// returned by RoundTripper.
+//
+// Example:
+//    	clientAspect := ginmon.NewClientAspect("Client")
+//    	clientAspect.StartTimer(time.Minute)
+//    	client := &http.Client{Transport: clientAspect.RoundTripper(nil)}
+type ClientAspect struct {
+	lock        sync.RWMutex
+	name        string
+	trace       bool
+	windows     map[string]*clientWindow // guarded by lock
+	windowStart time.Time
+	Stats       ClientStats
+}
+
+// NewClientAspect returns a new initialized ClientAspect, that is
+// served as name.
+func NewClientAspect(name string) *ClientAspect {
+	return &ClientAspect{
+		name:        name,
+		windows:     make(map[string]*clientWindow),
+		windowStart: time.Now(),
+		Stats:       ClientStats{Endpoints: make(map[string]ClientEndpointData)},
+	}
+}
+
+// EnableTrace records the durations of DNS lookup, connect, TLS
+// handshake and time to first byte with httptrace. Reused connections
+// have no DNS, connect and TLS phases. It has to be called before
+// RoundTripper is used.
+func (ca *ClientAspect) EnableTrace() {
+	ca.trace = true
+}
+
+// StartTimer will call a forever loop in a goroutine to calculate
+// metrics for measurements every d ticks.
+func (ca *ClientAspect) StartTimer(d time.Duration) {
+	timer := time.Tick(d)
+	go func() {
+		for {
+			<-timer
+			ca.calculate()
+		}
+	}()
+}
+
+// GetStats to fulfill aspects.Aspect interface, it returns the data
+// that will be served as JSON.
+func (ca *ClientAspect) GetStats() interface{} {
+	ca.lock.RLock()
+	defer ca.lock.RUnlock()
+	return ca.Stats
+}
+
+// Name to fulfill aspects.Aspect interface, it will return the name
+// of the JSON object that will be served.
+func (ca *ClientAspect) Name() string {
+	return ca.name
+}
+
+// InRoot to fulfill aspects.Aspect interface, it will return where to
+// put the JSON object into the monitoring endpoint.
+func (ca *ClientAspect) InRoot() bool {
+	return false
+}
+
+// RoundTripper returns an http.RoundTripper, that records all
+// requests sent by next. If next is nil http.DefaultTransport is used.
+func (ca *ClientAspect) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &clientRoundTripper{ca: ca, next: next}
+}
+
+type clientRoundTripper struct {
+	ca   *ClientAspect
+	next http.RoundTripper
+}
+
+func (rt *clientRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	var pt *phaseTrace
+	if rt.ca.trace {
+		pt = &phaseTrace{start: start, phases: make(map[string]float64)}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), pt.clientTrace()))
+	}
+
+	resp, err := rt.next.RoundTrip(req)
+	took := float64(time.Since(start))
+
+	var phases map[string]float64
+	if pt != nil {
+		phases = pt.result()
+	}
+	key := req.Method + " " + req.URL.Host
+	if err != nil {
+		rt.ca.add(key, 0, errorType(err), took, phases)
+	} else {
+		rt.ca.add(key, resp.StatusCode, "", took, phases)
+	}
+	return resp, err
+}
+
+// phaseTrace measures the phases of a request, its callbacks can be
+// called concurrently.
+type phaseTrace struct {
+	sync.Mutex
+	start, dnsStart, connectStart, tlsStart time.Time
+	phases                                  map[string]float64
+}
+
+func (pt *phaseTrace) clientTrace() *httptrace.ClientTrace {
+	since := func(phase string, start *time.Time) {
+		pt.Lock()
+		defer pt.Unlock()
+		if !start.IsZero() {
+			pt.phases[phase] = float64(time.Since(*start))
+		}
+	}
+	begin := func(start *time.Time) {
+		pt.Lock()
+		defer pt.Unlock()
+		*start = time.Now()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { begin(&pt.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { since(PhaseDNS, &pt.dnsStart) },
+		ConnectStart:      func(string, string) { begin(&pt.connectStart) },
+		ConnectDone:       func(string, string, error) { since(PhaseConnect, &pt.connectStart) },
+		TLSHandshakeStart: func() { begin(&pt.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { since(PhaseTLS, &pt.tlsStart) },
+		// time to first byte is measured from the start of the request
+		GotFirstResponseByte: func() { since(PhaseTTFB, &pt.start) },
+	}
+}
+
+// result returns a copy of the measured phases, such that late
+// callbacks of the trace do not change it.
+func (pt *phaseTrace) result() map[string]float64 {
+	pt.Lock()
+	defer pt.Unlock()
+	res := make(map[string]float64, len(pt.phases))
+	for phase, d := range pt.phases {
+		res[phase] = d
+	}
+	return res
+}
+
+// errorType classifies errors of http.RoundTripper.
+func errorType(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var record tls.RecordHeaderError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorCanceled
+	case errors.As(err, &dnsErr):
+		return ErrorDNS
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return ErrorConnectionReset
+	case errors.As(err, &unknownAuthority), errors.As(err, &hostname),
+		errors.As(err, &invalid), errors.As(err, &record):
+		return ErrorTLS
+	}
+	return ErrorOther
+}
+
+// add records one request, code is 0 if the request failed with an
+// error of errType.
+func (ca *ClientAspect) add(key string, code int, errType string, latency float64, phases map[string]float64) {
+	ca.lock.Lock()
+	defer ca.lock.Unlock()
+
+	w, ok := ca.windows[key]
+	if !ok {
+		w = &clientWindow{
+			codes:  make(map[int]int),
+			errors: make(map[string]int),
+			phases: make(map[string][]float64),
+		}
+		ca.windows[key] = w
+	}
+	if errType != "" {
+		w.errors[errType]++
+	} else {
+		w.codes[code]++
+	}
+	w.latencies = append(w.latencies, latency)
+	for phase, d := range phases {
+		w.phases[phase] = append(w.phases[phase], d)
+	}
+}
+
+// calculate swaps the collected requests under lock and aggregates
+// them afterwards.
+func (ca *ClientAspect) calculate() {
+	now := time.Now()
+	window := now.Sub(ca.windowStart)
+	ca.windowStart = now
+
+	ca.lock.Lock()
+	windows := ca.windows
+	ca.windows = make(map[string]*clientWindow, len(windows))
+	ca.lock.Unlock()
+
+	stats := ClientStats{
+		Endpoints:     make(map[string]ClientEndpointData, len(windows)),
+		WindowSeconds: window.Seconds(),
+		Timestamp:     now,
+	}
+	for key, w := range windows {
+		d := ClientEndpointData{
+			Count:   len(w.latencies),
+			Codes:   w.codes,
+			Errors:  w.errors,
+			Latency: distributionData(w.latencies),
+		}
+		d.Latency.Kind = KindDistribution.String()
+		d.Latency.WindowSeconds = window.Seconds()
+		d.Latency.RatePerSecond = perSecond(float64(d.Count), window)
+		d.Latency.Timestamp = now
+		if len(w.phases) > 0 {
+			d.Phases = make(map[string]GenericChannelData, len(w.phases))
+			for phase, durations := range w.phases {
+				p := distributionData(durations)
+				p.Kind = KindDistribution.String()
+				d.Phases[phase] = p
+			}
+		}
+		stats.Endpoints[key] = d
+	}
+
+	ca.lock.Lock()
+	ca.Stats = stats
+	ca.lock.Unlock()
+}
@@ -0,0 +1,116 @@
+package ginmon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClientAspect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	down := httptest.NewServer(nil)
+	down.Close()
+
+	ca := NewClientAspect("Client")
+	ca.EnableTrace()
+	client := &http.Client{Transport: ca.RoundTripper(nil)}
+	for _, url := range []string{srv.URL, srv.URL, srv.URL + "/missing", down.URL} {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+	ca.calculate()
+	stats := ca.GetStats().(ClientStats)
+
+	d := stats.Endpoints["GET "+srv.Listener.Addr().String()]
+	if assert.Equal(t, 3, d.Count, "Count does not work, expect %d but got %d %s", 3, d.Count, ballotX) {
+		t.Logf("Count works, expected %d %s", d.Count, checkMark)
+	}
+	expect := map[int]int{200: 2, 404: 1}
+	if assert.Equal(t, expect, d.Codes, "Codes does not work, expect %v but got %v %s", expect, d.Codes, ballotX) {
+		t.Logf("Codes works, expected %v %s", d.Codes, checkMark)
+	}
+	if assert.Equal(t, 3, d.Latency.Count) && assert.True(t, d.Latency.Max > 0, "Latency does not work %s", ballotX) {
+		t.Logf("Latency works %s", checkMark)
+	}
+	if assert.Equal(t, 1, d.Phases[PhaseConnect].Count, "Connect phase does not work, expect %d but got %d %s",
+		1, d.Phases[PhaseConnect].Count, ballotX) && assert.Equal(t, 3, d.Phases[PhaseTTFB].Count) {
+		t.Logf("Phases work %s", checkMark)
+	}
+
+	d = stats.Endpoints["GET "+down.Listener.Addr().String()]
+	if assert.Equal(t, 1, d.Errors[ErrorConnectionRefused], "Errors does not work, expect %v but got %v %s",
+		1, d.Errors, ballotX) {
+		t.Logf("Errors works, expected %v %s", d.Errors, checkMark)
+	}
+}
+
+func Test_ErrorType(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		expect string
+	}{
+		{context.Canceled, ErrorCanceled},
+		{context.DeadlineExceeded, ErrorTimeout},
+		{&net.DNSError{Err: "no such host", Name: "example.invalid"}, ErrorDNS},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, ErrorConnectionRefused},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, ErrorConnectionReset},
+		{&net.OpError{Op: "dial", Err: timeoutError{}}, ErrorTimeout},
+		{errors.New("boom"), ErrorOther},
+	} {
+		got := errorType(tc.err)
+		if assert.Equal(t, tc.expect, got, "Error type of %v does not work, expect %s but got %s %s",
+			tc.err, tc.expect, got, ballotX) {
+			t.Logf("Error type of %v works, expected %s %s", tc.err, got, checkMark)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func Test_ClientAspectSingleRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	ca := NewClientAspect("Client")
+	ca.EnableTrace()
+	resp, err := (&http.Client{Transport: ca.RoundTripper(nil)}).Get(srv.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+	ca.calculate()
+	_, err = json.Marshal(ca.GetStats())
+	if assert.NoError(t, err, "Stats of one request should be encoded %s", ballotX) {
+		t.Logf("Stats of one request are encoded %s", checkMark)
+	}
+}
+
+func Test_PhaseTraceResult(t *testing.T) {
+	pt := &phaseTrace{start: time.Now(), phases: make(map[string]float64)}
+	trace := pt.clientTrace()
+	trace.GotFirstResponseByte()
+	res := pt.result()
+	trace.DNSStart(httptrace.DNSStartInfo{})
+	trace.DNSDone(httptrace.DNSDoneInfo{})
+	if assert.Len(t, res, 1, "Result should not change by late callbacks %s", ballotX) {
+		t.Logf("Result does not change by late callbacks %s", checkMark)
+	}
+}
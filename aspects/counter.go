@@ -7,10 +7,13 @@ import (
 )
 
 // CounterHandler is a Gin middleware function that increments a
-// global counter on each request.
-func CounterHandler(ca *CounterAspect) gin.HandlerFunc {
+// global counter on each request, that passes all filters.
+func CounterHandler(ca *CounterAspect, filters ...Filter) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ctx.Next()
+		if !record(ctx, filters) {
+			return
+		}
 		ca.inc <- tuple{
 			path: ctx.Request.URL.Path,
 			code: ctx.Writer.Status(),
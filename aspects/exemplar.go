@@ -0,0 +1,72 @@
+package ginmon
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys of the exemplars of a distribution.
+const (
+	ExemplarMax = "max"
+	ExemplarP90 = "p90"
+	ExemplarP95 = "p95"
+	ExemplarP99 = "p99"
+)
+
+// Exemplar links a value of a distribution to the trace of the
+// request, that observed it.
+type Exemplar struct {
+	TraceID   string    `json:"trace_id"`
+	Value     float64   `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// OpenMetrics returns the exemplar in OpenMetrics syntax, like
+// # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 0.42 1700000000.123
+// The value is used as it is, it has to be in the unit of the metric.
+// The trace ID is escaped like a label value.
+func (e Exemplar) OpenMetrics() string {
+	ts := float64(e.Timestamp.UnixNano()) / float64(time.Second)
+	return `# {trace_id="` + labelEscaper.Replace(e.TraceID) + `"} ` +
+		strconv.FormatFloat(e.Value, 'g', -1, 64) + " " +
+		strconv.FormatFloat(ts, 'f', 3, 64)
+}
+
+// labelEscaper escapes label values of the text formats.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// exemplarsFor selects the exemplars of traced values for the
+// quantiles of a distribution. The exemplar of a quantile is the
+// smallest traced value of its bucket, p90 is [p90, p95), p95 is
+// [p95, p99) and p99 is [p99, max]. The exemplar of ExemplarMax is
+// the largest traced value, which is the max if it was traced.
+func exemplarsFor(traced []Exemplar, p90, p95, p99 float64) map[string]Exemplar {
+	if len(traced) == 0 {
+		return nil
+	}
+	buckets := []struct {
+		name   string
+		lo, hi float64
+	}{
+		{ExemplarP90, p90, p95},
+		{ExemplarP95, p95, p99},
+		{ExemplarP99, p99, math.Inf(1)},
+	}
+	res := make(map[string]Exemplar, len(buckets)+1)
+	for _, e := range traced {
+		if max, ok := res[ExemplarMax]; !ok || e.Value > max.Value {
+			res[ExemplarMax] = e
+		}
+		for _, b := range buckets {
+			if e.Value < b.lo || e.Value >= b.hi {
+				continue
+			}
+			if cur, ok := res[b.name]; !ok || e.Value < cur.Value {
+				res[b.name] = e
+			}
+		}
+	}
+	return res
+}
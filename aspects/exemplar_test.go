@@ -0,0 +1,110 @@
+package ginmon
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func Test_ExemplarsFor(t *testing.T) {
+	traced := []Exemplar{{TraceID: "a", Value: 50}, {TraceID: "b", Value: 91}, {TraceID: "c", Value: 92},
+		{TraceID: "d", Value: 97}, {TraceID: "e", Value: 99}, {TraceID: "f", Value: 100}}
+	got := exemplarsFor(traced, 90, 95, 99)
+	expect := map[string]string{ExemplarMax: "f", ExemplarP90: "b", ExemplarP95: "d", ExemplarP99: "e"}
+	ids := make(map[string]string, len(got))
+	for name, e := range got {
+		ids[name] = e.TraceID
+	}
+	if assert.Equal(t, expect, ids, "exemplarsFor does not work, expect %v but got %v %s", expect, ids, ballotX) {
+		t.Logf("exemplarsFor works, expected %v %s", ids, checkMark)
+	}
+	assert.Nil(t, exemplarsFor(nil, 1, 2, 3), "exemplarsFor without traced values should be nil %s", ballotX)
+}
+
+func Test_ExemplarOpenMetrics(t *testing.T) {
+	e := Exemplar{TraceID: testTraceID, Value: 0.25, Timestamp: time.Unix(1700000000, 123000000)}
+	expect := `# {trace_id="` + testTraceID + `"} 0.25 1700000000.123`
+	if got := e.OpenMetrics(); assert.Equal(t, expect, got, "OpenMetrics does not work, expect %q but got %q %s", expect, got, ballotX) {
+		t.Logf("OpenMetrics works, expected %q %s", got, checkMark)
+	}
+}
+
+func Test_ValidTraceID(t *testing.T) {
+	for id, expect := range map[string]bool{
+		testTraceID:             true,
+		"trace-1_a.b:c":         true,
+		"":                      false,
+		`a"} 1 # {x="`:          false,
+		"a b":                   false,
+		strings.Repeat("a", 65): false,
+		"träce":                 false,
+	} {
+		if got := validTraceID(id); assert.Equal(t, expect, got, "validTraceID(%q) does not work, expect %v but got %v %s", id, expect, got, ballotX) {
+			t.Logf("validTraceID(%q) works, expected %v %s", id, got, checkMark)
+		}
+	}
+	e := Exemplar{TraceID: "a\"b\\c\nd"}
+	expect := `# {trace_id="a\"b\\c\nd"} 0 `
+	if got := e.OpenMetrics(); assert.True(t, strings.HasPrefix(got, expect), "OpenMetrics should escape the trace ID, expect %q but got %q %s", expect, got, ballotX) {
+		t.Logf("OpenMetrics escapes the trace ID %s", checkMark)
+	}
+}
+
+func Test_RequestTimeExemplars(t *testing.T) {
+	gin.SetMode(TestMode)
+	rt := NewRequestTimeAspect()
+	rt.EnableExemplars("X-Trace-Id")
+	router := gin.New()
+	router.Use(RequestTimeHandler(rt))
+	router.GET("/", func(c *gin.Context) {})
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		if i%2 == 0 {
+			req.Header.Set("X-Trace-Id", "trace-"+strconv.Itoa(i))
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	rt.calculate()
+
+	max, ok := rt.Exemplars[ExemplarMax]
+	if assert.True(t, ok, "Exemplars do not work, got %v %s", rt.Exemplars, ballotX) &&
+		assert.Contains(t, max.TraceID, "trace-") && assert.True(t, max.Value <= rt.Max) {
+		t.Logf("Exemplars work, got %v %s", rt.Exemplars, checkMark)
+	}
+	rt.calculate()
+	assert.Empty(t, rt.traced, "Exemplars are not reset %s", ballotX)
+}
+
+func Test_GenericChannelExemplars(t *testing.T) {
+	gca := NewGenericChannelAspect("Exemplars")
+	for i := 1; i <= 100; i++ {
+		if i == 100 {
+			gca.ObserveExemplar("latency", float64(i), testTraceID)
+			continue
+		}
+		gca.Observe("latency", float64(i))
+	}
+	gca.ObserveExemplar("jobs", 1, testTraceID)
+	gca.ObserveExemplar("invalid", 1, `a"b`)
+	gca.Register("jobs", KindCounter)
+	gca.calculate()
+	stats := gca.GetStats().(GenericChannelStats).Metrics
+
+	expect := Exemplar{TraceID: testTraceID, Value: 100}
+	for _, name := range []string{ExemplarMax, ExemplarP99} {
+		got := stats["latency"].Exemplars[name]
+		got.Timestamp = time.Time{}
+		if assert.Equal(t, expect, got, "Exemplar %s does not work, expect %v but got %v %s", name, expect, got, ballotX) {
+			t.Logf("Exemplar %s works, expected %v %s", name, got, checkMark)
+		}
+	}
+	assert.Nil(t, stats["jobs"].Exemplars, "Counters should not have exemplars %s", ballotX)
+	assert.Nil(t, stats["invalid"].Exemplars, "Invalid trace IDs should not be kept %s", ballotX)
+}
@@ -0,0 +1,125 @@
+package ginmon
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Filter decides if a request is recorded by a ginmon middleware. It
+// is called after the handlers, such that it can use the status
+// code. A request is recorded if all filters return true.
+//
+// Example:
+//    	router.Use(ginmon.CounterHandler(counterAspect,
+//    		ginmon.Exclude(ginmon.Path("/healthz", "/metrics"), ginmon.Method("OPTIONS"))))
+type Filter func(ctx *gin.Context) bool
+
+// Matcher matches requests, it can be used to write custom
+// predicates for Include and Exclude.
+type Matcher func(ctx *gin.Context) bool
+
+// Include returns a Filter, that records only requests matched by one
+// of matchers.
+func Include(matchers ...Matcher) Filter {
+	return func(ctx *gin.Context) bool {
+		return matchAny(ctx, matchers)
+	}
+}
+
+// Exclude returns a Filter, that does not record requests matched by
+// one of matchers.
+func Exclude(matchers ...Matcher) Filter {
+	return func(ctx *gin.Context) bool {
+		return !matchAny(ctx, matchers)
+	}
+}
+
+func matchAny(ctx *gin.Context, matchers []Matcher) bool {
+	for _, m := range matchers {
+		if m(ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+// record returns true if the request passes all filters.
+func record(ctx *gin.Context, filters []Filter) bool {
+	for _, f := range filters {
+		if !f(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+// Path matches requests with one of the given paths.
+func Path(paths ...string) Matcher {
+	set := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		set[p] = true
+	}
+	return func(ctx *gin.Context) bool {
+		return set[ctx.Request.URL.Path]
+	}
+}
+
+// PathPrefix matches requests with a path starting with one of the
+// given prefixes.
+func PathPrefix(prefixes ...string) Matcher {
+	return func(ctx *gin.Context) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(ctx.Request.URL.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// PathGlob matches requests with a path matching one of the given
+// patterns, see path.Match for the syntax. It panics if a pattern is
+// malformed.
+func PathGlob(patterns ...string) Matcher {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic("ginmon: invalid glob " + pattern + ": " + err.Error())
+		}
+	}
+	return func(ctx *gin.Context) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, ctx.Request.URL.Path); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// PathRegexp matches requests with a path matching one of the given
+// regular expressions.
+func PathRegexp(res ...*regexp.Regexp) Matcher {
+	return func(ctx *gin.Context) bool {
+		for _, re := range res {
+			if re.MatchString(ctx.Request.URL.Path) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Method matches requests with one of the given HTTP methods.
+func Method(methods ...string) Matcher {
+	return func(ctx *gin.Context) bool {
+		for _, method := range methods {
+			if strings.EqualFold(ctx.Request.Method, method) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,81 @@
+package ginmon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func filterGinCtx(method, path string) *gin.Context {
+	return &gin.Context{
+		Request: &http.Request{
+			Method: method,
+			URL:    &url.URL{Path: path},
+		},
+	}
+}
+
+func Test_Filter(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		filters []Filter
+		method  string
+		path    string
+		expect  bool
+	}{
+		{"no filter", nil, "GET", testpath, true},
+		{"exclude path", []Filter{Exclude(Path("/healthz", "/metrics"))}, "GET", "/healthz", false},
+		{"exclude other path", []Filter{Exclude(Path("/healthz"))}, "GET", "/healthz/x", true},
+		{"exclude prefix", []Filter{Exclude(PathPrefix("/internal/"))}, "GET", "/internal/debug", false},
+		{"include glob", []Filter{Include(PathGlob("/api/*/users"))}, "GET", "/api/v1/users", true},
+		{"include other glob", []Filter{Include(PathGlob("/api/*/users"))}, "GET", "/api/v1/groups", false},
+		{"exclude regexp", []Filter{Exclude(PathRegexp(regexp.MustCompile(`^/static/.*\.js$`)))}, "GET", "/static/app.js", false},
+		{"exclude method", []Filter{Exclude(Method("options"))}, "OPTIONS", testpath, false},
+		{"include method", []Filter{Include(Method("GET", "POST"))}, "PUT", testpath, false},
+		{"custom predicate", []Filter{Exclude(func(ctx *gin.Context) bool {
+			return ctx.Request.Method == "HEAD"
+		})}, "HEAD", testpath, false},
+		{"all filters", []Filter{Include(PathPrefix("/api/")), Exclude(Method("DELETE"))}, "DELETE", "/api/x", false},
+	} {
+		got := record(filterGinCtx(tc.method, tc.path), tc.filters)
+		if assert.Equal(t, tc.expect, got, "Filter %s does not work, expect %v but got %v %s",
+			tc.name, tc.expect, got, ballotX) {
+			t.Logf("Filter %s works, expected %v %s", tc.name, got, checkMark)
+		}
+	}
+
+	assert.Panics(t, func() { PathGlob("[") }, "Invalid glob should panic %s", ballotX)
+}
+
+func Test_CounterHandlerFilter(t *testing.T) {
+	ca := NewCounterAspect()
+	handler := CounterHandler(ca, Exclude(Path("/healthz")))
+	done := make(chan struct{})
+	go func() {
+		for tup := range ca.inc {
+			ca.increment(tup)
+			done <- struct{}{}
+		}
+	}()
+
+	gin.SetMode(TestMode)
+	for _, p := range []string{"/healthz", testpath} {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = &http.Request{Method: "GET", URL: &url.URL{Path: p}}
+		handler(ctx)
+	}
+	<-done
+	close(ca.inc)
+	ca.reset()
+
+	expect := map[string]int{testpath: 1}
+	if assert.Equal(t, expect, ca.Requests, "CounterHandler filter does not work, expect %v but got %v %s",
+		expect, ca.Requests, ballotX) {
+		t.Logf("CounterHandler filter works, expected %v %s", ca.Requests, checkMark)
+	}
+}
@@ -2,17 +2,55 @@ package ginmon
 
 import (
 	"bytes"
+	"container/list"
 	"encoding/gob"
+	"math"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// MetricKind defines how the values of a name are aggregated.
+type MetricKind int
+
+const (
+	// KindDefault uses the kind registered for a name, or
+	// KindDistribution if none was registered.
+	KindDefault MetricKind = iota
+	// KindDistribution calculates count, min, max, mean, stdev and
+	// percentiles of all values in a time frame.
+	KindDistribution
+	// KindCounter sums up all values in a time frame.
+	KindCounter
+	// KindGauge keeps the last value, and min and max of all values
+	// in a time frame.
+	KindGauge
+)
+
+// String returns the name of the kind as exposed in JSON.
+func (k MetricKind) String() string {
+	switch k {
+	case KindCounter:
+		return "counter"
+	case KindGauge:
+		return "gauge"
+	default:
+		return "distribution"
+	}
+}
+
 // DataChannel is the data you pass into the channel. Using Name we
-// will put the Value into the right bucket.
+// will put the Value into the right bucket. Kind is optional and
+// overrides the kind registered for Name. TraceID is optional and
+// keeps the value as exemplar of a distribution, IDs with other
+// characters than letters, digits and "-_.:" or longer than 64
+// characters are ignored.
 type DataChannel struct {
-	Name  string
-	Value float64
+	Name    string
+	Value   float64
+	Kind    MetricKind
+	TraceID string
 }
 
 type dataStore struct {
@@ -20,46 +58,115 @@ type dataStore struct {
 	data map[string][]float64
 }
 
-func NewDataStore() dataStore {
-	return dataStore{data: make(map[string][]float64)}
+func NewDataStore() *dataStore {
+	return &dataStore{data: make(map[string][]float64)}
 }
 
-func (ds dataStore) ResetKey(key string) {
+func (ds *dataStore) ResetKey(key string) {
 	ds.Lock()
 	defer ds.Unlock()
 	ds.data[key] = make([]float64, 0)
 }
 
-func (ds dataStore) Get(key string) []float64 {
+func (ds *dataStore) Get(key string) []float64 {
 	ds.RLock()
 	defer ds.RUnlock()
 	return ds.data[key]
 }
 
-func (ds dataStore) Add(key string, value float64) {
+func (ds *dataStore) Add(key string, value float64) {
 	ds.data[key] = append(ds.data[key], value)
 }
 
+// EvictionPolicy defines what happens if a new name is added to a
+// GenericChannelAspect that already has the maximum number of names.
+type EvictionPolicy int
+
+const (
+	// EvictLeastRecentlyUsed removes the name that did not get a value
+	// for the longest time.
+	EvictLeastRecentlyUsed EvictionPolicy = iota
+	// RejectNewKeys drops the values of new names.
+	RejectNewKeys
+)
+
+// keyEntry is the element of the list of names ordered by usage.
+type keyEntry struct {
+	name     string
+	lastSeen time.Time
+}
+
 // GenericChannelAspect, exported fields are used to store json
 // fields. All fields are measured in nanoseconds.
 type GenericChannelAspect struct {
-	gcdLock   sync.RWMutex
-	name      string
-	tempStore dataStore
-	Gcd       map[string]GenericChannelData
+	dropped      uint64 // accessed atomically, first for 64-bit alignment
+	gcdLock      sync.RWMutex
+	name         string
+	tempStore    *dataStore
+	registered   map[string]MetricKind    // guarded by tempStore
+	kinds        map[string]MetricKind    // guarded by tempStore
+	keys         map[string]*list.Element // guarded by tempStore
+	lru          *list.List               // guarded by tempStore
+	evictedNames []string                 // guarded by tempStore
+	evicted      int                      // guarded by tempStore
+	expired      int                      // guarded by tempStore
+	ttl          time.Duration            // guarded by tempStore
+	maxKeys      int                      // guarded by tempStore
+	policy       EvictionPolicy           // guarded by tempStore
+	histograms   float64                  // guarded by tempStore
+	sampler      Sampler                  // guarded by tempStore
+	exemplars    map[string][]Exemplar    // guarded by tempStore
+	gauges       map[string]float64       // only used by calculate
+	windowStart  time.Time                // only used by calculate
+	ch           chan DataChannel
+	done         chan struct{}
+	closeOnce    sync.Once
+	wg           sync.WaitGroup
+	frame        GenericChannelStats // guarded by gcdLock, without Metrics
+	Gcd          map[string]GenericChannelData
 }
 
-// GenericChannelData
+// GenericChannelStats are the calculated data of a
+// GenericChannelAspect. Metrics are the data by name, Dropped is the
+// number of values dropped by TryObserve or RejectNewKeys, Expired and
+// Evicted the number of names removed by SetTTL and SetMaxKeys in the
+// time frame of WindowSeconds.
+type GenericChannelStats struct {
+	Metrics       map[string]GenericChannelData `json:"metrics"`
+	Dropped       int                           `json:"dropped"`
+	Expired       int                           `json:"expired"`
+	Evicted       int                           `json:"evicted"`
+	WindowSeconds float64                       `json:"window_seconds"`
+	Timestamp     time.Time                     `json:"timestamp"`
+}
+
+// GenericChannelData is the calculated data of one name. Value is
+// the sum of a counter or the last value of a gauge. RatePerSecond is
+// the Count, or the Sum of a counter, divided by the length of the
+// time frame. Count, Sum and the Value of counters are scaled up by
+// SampleRate, if a Sampler is set.
 type GenericChannelData struct {
-	Count     int       `json:"count"`
-	Min       float64   `json:"min"`
-	Max       float64   `json:"max"`
-	Mean      float64   `json:"mean"`
-	Stdev     float64   `json:"stdev"`
-	P90       float64   `json:"p90"`
-	P95       float64   `json:"p95"`
-	P99       float64   `json:"p99"`
-	Timestamp time.Time `json:"timestamp"`
+	Kind          string    `json:"kind"`
+	Value         float64   `json:"value"`
+	Count         int       `json:"count"`
+	Sum           float64   `json:"sum"`
+	RatePerSecond float64   `json:"rate_per_second"`
+	WindowSeconds float64   `json:"window_seconds"`
+	SampleRate    float64   `json:"sample_rate"`
+	Min           float64   `json:"min"`
+	Max           float64   `json:"max"`
+	Mean          float64   `json:"mean"`
+	Stdev         float64   `json:"stdev"`
+	P90           float64   `json:"p90"`
+	P95           float64   `json:"p95"`
+	P99           float64   `json:"p99"`
+	Timestamp     time.Time `json:"timestamp"`
+	// Histogram is set for distributions, if enabled by
+	// EnableHistograms.
+	Histogram *Histogram `json:"histogram,omitempty"`
+	// Exemplars are set for distributions with values that have a
+	// TraceID, by ExemplarMax, ExemplarP90, ExemplarP95 and ExemplarP99.
+	Exemplars map[string]Exemplar `json:"exemplars,omitempty"`
 }
 
 // NewGenericChannelAspect returns a new initialized GenericChannelAspect
@@ -67,18 +174,31 @@ type GenericChannelData struct {
 func NewGenericChannelAspect(name string) *GenericChannelAspect {
 	gc := &GenericChannelAspect{name: name}
 	gc.tempStore = NewDataStore()
+	gc.registered = make(map[string]MetricKind)
+	gc.kinds = make(map[string]MetricKind)
+	gc.keys = make(map[string]*list.Element)
+	gc.lru = list.New()
+	gc.exemplars = make(map[string][]Exemplar)
+	gc.gauges = make(map[string]float64)
+	gc.done = make(chan struct{})
+	gc.windowStart = time.Now()
 	gc.Gcd = make(map[string]GenericChannelData, 0)
 	return gc
 }
 
-// StartTimer will call a forever loop in a goroutine to calculate
-// metrics for measurements every d ticks.
+// StartTimer will call a loop in a goroutine to calculate metrics for
+// measurements every d ticks, until Close is called.
 func (gc *GenericChannelAspect) StartTimer(d time.Duration) {
-	timer := time.Tick(d)
+	ticker := time.NewTicker(d)
 	go func() {
+		defer ticker.Stop()
 		for {
-			<-timer
-			gc.calculate()
+			select {
+			case <-ticker.C:
+				gc.calculate()
+			case <-gc.done:
+				return
+			}
 		}
 	}()
 }
@@ -87,16 +207,164 @@ func (gc *GenericChannelAspect) StartTimer(d time.Duration) {
 // DataChannel, such that you can send arbitrary key (string) value
 // (float64) pairs to it.
 func (gc *GenericChannelAspect) SetupGenericChannelAspect() chan DataChannel {
-	lgc := gc // save gc in closure
-	ch := make(chan DataChannel)
+	return gc.SetupBufferedGenericChannelAspect(0)
+}
+
+// SetupBufferedGenericChannelAspect returns a channel for type
+// DataChannel with the given buffer size. Sending to it blocks only if
+// the buffer is full, use TryObserve to never block. It should be
+// called only once for each GenericChannelAspect.
+func (gc *GenericChannelAspect) SetupBufferedGenericChannelAspect(size int) chan DataChannel {
+	ch := make(chan DataChannel, size)
+	gc.ch = ch
+	gc.wg.Add(1)
 	go func() {
+		defer gc.wg.Done()
 		for {
-			lgc.add(<-ch)
+			select {
+			case dc := <-ch:
+				gc.add(dc)
+			case <-gc.done:
+				// drain values that were buffered before Close
+				for {
+					select {
+					case dc := <-ch:
+						gc.add(dc)
+					default:
+						return
+					}
+				}
+			}
 		}
 	}()
 	return ch
 }
 
+// TryObserve sends dc to the channel created by
+// SetupGenericChannelAspect without blocking. It returns false and
+// counts dc as dropped, if the channel is full, not set up or the
+// GenericChannelAspect is closed.
+func (gc *GenericChannelAspect) TryObserve(dc DataChannel) bool {
+	select {
+	case <-gc.done:
+		atomic.AddUint64(&gc.dropped, 1)
+		return false
+	default:
+	}
+
+	select {
+	case gc.ch <- dc:
+		return true
+	default:
+		atomic.AddUint64(&gc.dropped, 1)
+		return false
+	}
+}
+
+// Close stops the goroutines started by StartTimer and
+// SetupGenericChannelAspect. Values already buffered in the channel
+// are added before Close returns, values sent afterwards are never
+// read. It is safe to call Close more than once.
+func (gc *GenericChannelAspect) Close() {
+	gc.closeOnce.Do(func() {
+		close(gc.done)
+	})
+	gc.wg.Wait()
+}
+
+// Observe adds value to name without using a channel. It is safe for
+// concurrent use.
+func (gc *GenericChannelAspect) Observe(name string, value float64) {
+	gc.add(DataChannel{Name: name, Value: value})
+}
+
+// ObserveExemplar adds value to name like Observe and keeps it as
+// exemplar of the trace traceID.
+func (gc *GenericChannelAspect) ObserveExemplar(name string, value float64, traceID string) {
+	gc.add(DataChannel{Name: name, Value: value, TraceID: traceID})
+}
+
+// Inc increments the counter name by one.
+func (gc *GenericChannelAspect) Inc(name string) {
+	gc.add(DataChannel{Name: name, Value: 1, Kind: KindCounter})
+}
+
+// Set sets the gauge name to value.
+func (gc *GenericChannelAspect) Set(name string, value float64) {
+	gc.add(DataChannel{Name: name, Value: value, Kind: KindGauge})
+}
+
+// Time returns a function that adds the time in nanoseconds passed
+// since calling Time to the distribution name.
+//
+// Example:
+//
+//	defer gc.Time("db_query")()
+func (gc *GenericChannelAspect) Time(name string) func() {
+	start := time.Now()
+	return func() {
+		gc.add(DataChannel{
+			Name:  name,
+			Value: float64(time.Since(start)),
+			Kind:  KindDistribution,
+		})
+	}
+}
+
+// Register sets the kind used to aggregate the values of name. Values
+// sent with a Kind other than KindDefault override it.
+func (gc *GenericChannelAspect) Register(name string, kind MetricKind) {
+	gc.tempStore.Lock()
+	defer gc.tempStore.Unlock()
+
+	gc.registered[name] = kind
+	if gc.touch(name) {
+		if _, ok := gc.tempStore.data[name]; !ok {
+			gc.tempStore.data[name] = make([]float64, 0)
+		}
+	}
+}
+
+// EnableHistograms exposes a Histogram with the given relative error
+// for each distribution, such that the data of many instances can be
+// combined with Merge. A relativeError of 0 disables histograms.
+func (gc *GenericChannelAspect) EnableHistograms(relativeError float64) {
+	gc.tempStore.Lock()
+	defer gc.tempStore.Unlock()
+	gc.histograms = relativeError
+}
+
+// SetSampler records only the observations of counters and
+// distributions sampled by s, gauges are always recorded.
+func (gc *GenericChannelAspect) SetSampler(s Sampler) {
+	gc.tempStore.Lock()
+	defer gc.tempStore.Unlock()
+	gc.sampler = s
+}
+
+// SetTTL sets the time after which a name without values is removed
+// from Gcd. The default 0 keeps all names forever. Names are checked
+// in each time frame of StartTimer, the kind set by Register is kept.
+func (gc *GenericChannelAspect) SetTTL(ttl time.Duration) {
+	gc.tempStore.Lock()
+	defer gc.tempStore.Unlock()
+	gc.ttl = ttl
+}
+
+// SetMaxKeys limits the number of names to maxKeys, policy defines
+// what happens with a new name if the limit is reached. The default 0
+// does not limit the number of names.
+func (gc *GenericChannelAspect) SetMaxKeys(maxKeys int, policy EvictionPolicy) {
+	gc.tempStore.Lock()
+	defer gc.tempStore.Unlock()
+	gc.maxKeys = maxKeys
+	gc.policy = policy
+	for gc.maxKeys > 0 && len(gc.keys) > gc.maxKeys {
+		gc.remove(gc.lru.Back().Value.(*keyEntry).name)
+		gc.evicted++
+	}
+}
+
 // GetStats to fulfill aspects.Aspect interface, it returns a copy of
 // the calculated data set that will be served as JSON.
 func (gc *GenericChannelAspect) GetStats() interface{} {
@@ -112,13 +380,14 @@ func (gc *GenericChannelAspect) GetStats() interface{} {
 		return err
 	}
 
-	var cpy map[string]GenericChannelData
-	err = dec.Decode(&cpy)
+	stats := gc.frame
+	stats.Metrics = make(map[string]GenericChannelData, len(gc.Gcd))
+	err = dec.Decode(&stats.Metrics)
 	if err != nil {
 		return err
 	}
 
-	return cpy
+	return stats
 }
 
 // Name to fulfill aspects.Aspect interface, it will return the name
@@ -137,40 +406,228 @@ func (gc *GenericChannelAspect) add(dc DataChannel) {
 	gc.tempStore.Lock()
 	defer gc.tempStore.Unlock()
 
+	if gc.sampler != nil && !gc.sampled(dc) {
+		return
+	}
+	if !gc.touch(dc.Name) {
+		atomic.AddUint64(&gc.dropped, 1)
+		return
+	}
+	if dc.Kind != KindDefault {
+		gc.kinds[dc.Name] = dc.Kind
+	}
 	gc.tempStore.Add(dc.Name, dc.Value)
+	if validTraceID(dc.TraceID) {
+		gc.exemplars[dc.Name] = append(gc.exemplars[dc.Name], Exemplar{
+			TraceID:   dc.TraceID,
+			Value:     dc.Value,
+			Timestamp: time.Now(),
+		})
+	}
 }
 
+// sampled returns true if dc is recorded by the sampler. Gauges are
+// never sampled, such that their last value is kept. Callers have to
+// hold the tempStore lock.
+func (gc *GenericChannelAspect) sampled(dc DataChannel) bool {
+	kind := dc.Kind
+	if kind == KindDefault {
+		kind = gc.kindOf(dc.Name)
+	}
+	return kind == KindGauge || gc.sampler.Sample()
+}
+
+// touch marks name as most recently used and evicts another name if
+// the limit of SetMaxKeys is reached. It returns false if name was
+// rejected. Callers have to hold the tempStore lock.
+func (gc *GenericChannelAspect) touch(name string) bool {
+	if e, ok := gc.keys[name]; ok {
+		gc.lru.MoveToFront(e)
+		return true
+	}
+	if gc.maxKeys > 0 && len(gc.keys) >= gc.maxKeys {
+		if gc.policy == RejectNewKeys {
+			return false
+		}
+		gc.remove(gc.lru.Back().Value.(*keyEntry).name)
+		gc.evicted++
+	}
+	gc.keys[name] = gc.lru.PushFront(&keyEntry{name: name, lastSeen: time.Now()})
+	return true
+}
+
+// remove deletes name from the tempStore, Gcd is cleaned up by the
+// next calculate. Callers have to hold the tempStore lock.
+func (gc *GenericChannelAspect) remove(name string) {
+	gc.lru.Remove(gc.keys[name])
+	delete(gc.keys, name)
+	delete(gc.kinds, name)
+	delete(gc.tempStore.data, name)
+	delete(gc.exemplars, name)
+	gc.evictedNames = append(gc.evictedNames, name)
+}
+
+// kindOf returns the kind of name, callers have to hold the tempStore
+// lock.
+func (gc *GenericChannelAspect) kindOf(name string) MetricKind {
+	if kind := gc.kinds[name]; kind != KindDefault {
+		return kind
+	}
+	if kind := gc.registered[name]; kind != KindDefault {
+		return kind
+	}
+	return KindDistribution
+}
+
+// calculate swaps the collected values under lock and aggregates them
+// afterwards, such that producers are not blocked while sorting.
 func (gc *GenericChannelAspect) calculate() {
+	now := time.Now()
+	window := now.Sub(gc.windowStart)
+	gc.windowStart = now
 	gc.tempStore.Lock()
-	defer gc.tempStore.Unlock()
-	for name, list := range gc.tempStore.data {
-		sortedSlice := list[:]
-		gc.tempStore.data[name] = make([]float64, 0)
-		l := len(sortedSlice)
-
-		// if tempStore is empty have to set everything to 0 and update timestamp
-		if l < 1 {
-			gc.gcdLock.Lock()
-			gc.Gcd[name] = GenericChannelData{Timestamp: time.Now()}
-			gc.gcdLock.Unlock()
-			continue
+	for name, values := range gc.tempStore.data {
+		e := gc.keys[name].Value.(*keyEntry)
+		if len(values) > 0 {
+			e.lastSeen = now
+		} else if gc.ttl > 0 && now.Sub(e.lastSeen) > gc.ttl {
+			gc.remove(name)
+			gc.expired++
 		}
+	}
+	data := gc.tempStore.data
+	kinds := make(map[string]MetricKind, len(data))
+	gc.tempStore.data = make(map[string][]float64, len(data))
+	for name := range data {
+		gc.tempStore.data[name] = make([]float64, 0)
+		kinds[name] = gc.kindOf(name)
+	}
+	exemplars := gc.exemplars
+	gc.exemplars = make(map[string][]Exemplar, len(exemplars))
+	removed := gc.evictedNames
+	gc.evictedNames = nil
+	evicted, expired := gc.evicted, gc.expired
+	gc.evicted, gc.expired = 0, 0
+	histograms := gc.histograms
+	rate := 1.0
+	if gc.sampler != nil {
+		rate = gc.sampler.Window()
+	}
+	gc.tempStore.Unlock()
 
-		sort.Float64s(sortedSlice)
-		m := mean(sortedSlice, l)
+	gc.gcdLock.Lock()
+	for _, name := range removed {
+		delete(gc.Gcd, name)
+		delete(gc.gauges, name)
+	}
+	gc.gcdLock.Unlock()
 
-		gc.gcdLock.Lock()
-		gc.Gcd[name] = GenericChannelData{
-			Timestamp: time.Now(),
-			Count:     l,
-			Min:       sortedSlice[0],
-			Max:       sortedSlice[l-1],
-			Mean:      m,
-			Stdev:     correctedStdev(sortedSlice, m, l),
-			P90:       p90(sortedSlice, l),
-			P95:       p95(sortedSlice, l),
-			P99:       p99(sortedSlice, l),
+	for name, list := range data {
+		var gcd GenericChannelData
+		kind := kinds[name]
+		switch kind {
+		case KindCounter:
+			gcd = counterData(list)
+			gcd.Value = scale(gcd.Value, rate)
+		case KindGauge:
+			last, seen := gc.gauges[name]
+			gcd = gaugeData(list, last, seen)
+			gc.gauges[name] = gcd.Value
+		default:
+			gcd = distributionData(list)
+			if histograms > 0 {
+				gcd.Histogram = newHistogramFrom(histograms, list)
+				gcd.Histogram.scale(rate)
+			}
+			if gcd.Count > 0 {
+				gcd.Exemplars = exemplarsFor(exemplars[name], gcd.P90, gcd.P95, gcd.P99)
+			}
+		}
+		gcd.SampleRate = 1
+		if kind != KindGauge {
+			gcd.Count = scaleCount(gcd.Count, rate)
+			gcd.Sum = scale(gcd.Sum, rate)
+			gcd.SampleRate = rate
+		}
+		gcd.Kind = kind.String()
+		gcd.Timestamp = time.Now()
+		gcd.WindowSeconds = window.Seconds()
+		gcd.RatePerSecond = perSecond(float64(gcd.Count), window)
+		if kind == KindCounter {
+			gcd.RatePerSecond = perSecond(gcd.Sum, window)
 		}
+
+		gc.gcdLock.Lock()
+		gc.Gcd[name] = gcd
 		gc.gcdLock.Unlock()
 	}
+
+	dropped := int(atomic.SwapUint64(&gc.dropped, 0))
+	gc.gcdLock.Lock()
+	gc.frame = GenericChannelStats{
+		Dropped:       dropped,
+		Expired:       expired,
+		Evicted:       evicted,
+		WindowSeconds: window.Seconds(),
+		Timestamp:     time.Now(),
+	}
+	gc.gcdLock.Unlock()
+}
+
+// counterData sums up all observations.
+func counterData(observations []float64) GenericChannelData {
+	l := len(observations)
+	s := sum(observations, l)
+	return GenericChannelData{Count: l, Sum: s, Value: s}
+}
+
+// gaugeData uses the last observation as value. If there are no
+// observations the last value of the previous time frame is kept.
+func gaugeData(observations []float64, last float64, seen bool) GenericChannelData {
+	l := len(observations)
+	if l < 1 {
+		if !seen {
+			return GenericChannelData{}
+		}
+		return GenericChannelData{Value: last, Min: last, Max: last}
+	}
+
+	gcd := GenericChannelData{
+		Count: l,
+		Sum:   sum(observations, l),
+		Value: observations[l-1],
+		Min:   observations[0],
+		Max:   observations[0],
+	}
+	for _, v := range observations[1:] {
+		gcd.Min = math.Min(gcd.Min, v)
+		gcd.Max = math.Max(gcd.Max, v)
+	}
+	return gcd
+}
+
+// distributionData calculates the statistics of all observations, it
+// will sort the given slice.
+func distributionData(observations []float64) GenericChannelData {
+	l := len(observations)
+	// if tempStore is empty have to set everything to 0
+	if l < 1 {
+		return GenericChannelData{}
+	}
+
+	sort.Float64s(observations)
+	s := sum(observations, l)
+	m := s / float64(l)
+
+	return GenericChannelData{
+		Count: l,
+		Sum:   s,
+		Min:   observations[0],
+		Max:   observations[l-1],
+		Mean:  m,
+		Stdev: correctedStdev(observations, m, l),
+		P90:   p90(observations, l),
+		P95:   p95(observations, l),
+		P99:   p99(observations, l),
+	}
 }
@@ -1,8 +1,11 @@
 package ginmon
 
 import (
+	"encoding/json"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -100,3 +103,311 @@ func TestGenericChannelAspect(t *testing.T) {
 	}
 
 }
+
+func TestGenericChannelAspectCounter(t *testing.T) {
+	gca := NewGenericChannelAspect("foo")
+	for i := 0; i < 10; i++ {
+		gca.add(DataChannel{Name: "hits", Value: 1, Kind: KindCounter})
+	}
+	gca.add(DataChannel{Name: "hits", Value: 5})
+
+	gca.calculate()
+	gcd := gca.Gcd["hits"]
+	if assert.Equal(t, "counter", gcd.Kind, "Kind does not work, expect %s but got %s %s",
+		"counter", gcd.Kind, ballotX) {
+		t.Logf("Kind works, expected %s %s", gcd.Kind, checkMark)
+	}
+	if assert.Equal(t, 15.0, gcd.Value, "Value does not work, expect %v but got %v %s",
+		15.0, gcd.Value, ballotX) {
+		t.Logf("Value works, expected %v %s", gcd.Value, checkMark)
+	}
+	if assert.Equal(t, 11, gcd.Count, "Count does not work, expect %d but got %d %s",
+		11, gcd.Count, ballotX) {
+		t.Logf("Count works, expected %d %s", gcd.Count, checkMark)
+	}
+
+	gca.calculate()
+	gcd = gca.Gcd["hits"]
+	if assert.Equal(t, 0.0, gcd.Value, "Value of an empty counter does not work, expect %v but got %v %s",
+		0.0, gcd.Value, ballotX) {
+		t.Logf("Value of an empty counter works, expected %v %s", gcd.Value, checkMark)
+	}
+}
+
+func TestGenericChannelAspectGauge(t *testing.T) {
+	gca := NewGenericChannelAspect("foo")
+	gca.Register("queue", KindGauge)
+	for _, v := range []float64{3, 7, 1, 4} {
+		gca.add(DataChannel{Name: "queue", Value: v})
+	}
+
+	gca.calculate()
+	gcd := gca.Gcd["queue"]
+	if assert.Equal(t, "gauge", gcd.Kind, "Kind does not work, expect %s but got %s %s",
+		"gauge", gcd.Kind, ballotX) {
+		t.Logf("Kind works, expected %s %s", gcd.Kind, checkMark)
+	}
+	if assert.Equal(t, 4.0, gcd.Value, "Value does not work, expect %v but got %v %s",
+		4.0, gcd.Value, ballotX) {
+		t.Logf("Value works, expected %v %s", gcd.Value, checkMark)
+	}
+	if assert.Equal(t, 1.0, gcd.Min, "Min does not work, expect %v but got %v %s",
+		1.0, gcd.Min, ballotX) {
+		t.Logf("Min works, expected %v %s", gcd.Min, checkMark)
+	}
+	if assert.Equal(t, 7.0, gcd.Max, "Max does not work, expect %v but got %v %s",
+		7.0, gcd.Max, ballotX) {
+		t.Logf("Max works, expected %v %s", gcd.Max, checkMark)
+	}
+
+	gca.calculate()
+	gcd = gca.Gcd["queue"]
+	if assert.Equal(t, 4.0, gcd.Value, "Value of a gauge without new values does not work, expect %v but got %v %s",
+		4.0, gcd.Value, ballotX) {
+		t.Logf("Value of a gauge without new values works, expected %v %s", gcd.Value, checkMark)
+	}
+	if assert.Equal(t, 0, gcd.Count, "Count of a gauge without new values does not work, expect %d but got %d %s",
+		0, gcd.Count, ballotX) {
+		t.Logf("Count of a gauge without new values works, expected %d %s", gcd.Count, checkMark)
+	}
+}
+
+func TestGenericChannelAspectTryObserve(t *testing.T) {
+	gca := NewGenericChannelAspect("foo")
+	if assert.False(t, gca.TryObserve(DataChannel{Name: "bar", Value: 1}),
+		"TryObserve without channel should drop %s", ballotX) {
+		t.Logf("TryObserve without channel drops %s", checkMark)
+	}
+
+	ch := gca.SetupBufferedGenericChannelAspect(10)
+	for i := 0; i < 5; i++ {
+		ch <- DataChannel{Name: "bar", Value: float64(i)}
+	}
+	for i := 0; i < 5; i++ {
+		gca.TryObserve(DataChannel{Name: "bar", Value: float64(i)})
+	}
+	gca.Close()
+	if assert.False(t, gca.TryObserve(DataChannel{Name: "bar", Value: 1}),
+		"TryObserve after Close should drop %s", ballotX) {
+		t.Logf("TryObserve after Close drops %s", checkMark)
+	}
+	gca.Close()
+
+	gca.calculate()
+	gcd := gca.Gcd["bar"]
+	dropped := gca.GetStats().(GenericChannelStats).Dropped
+	if assert.Equal(t, 10, gcd.Count, "Count does not work, expect %d but got %d %s",
+		10, gcd.Count, ballotX) {
+		t.Logf("Count works, expected %d %s", gcd.Count, checkMark)
+	}
+	if assert.Equal(t, 2, dropped, "Dropped does not work, expect %d but got %d %s",
+		2, dropped, ballotX) {
+		t.Logf("Dropped works, expected %d %s", dropped, checkMark)
+	}
+}
+
+func TestGenericChannelAspectTryObserveFull(t *testing.T) {
+	gca := NewGenericChannelAspect("foo")
+	gca.ch = make(chan DataChannel, 1) // no reader
+	gca.TryObserve(DataChannel{Name: "bar", Value: 1})
+	if assert.False(t, gca.TryObserve(DataChannel{Name: "bar", Value: 2}),
+		"TryObserve to a full channel should drop %s", ballotX) {
+		t.Logf("TryObserve to a full channel drops %s", checkMark)
+	}
+
+	gca.calculate()
+	dropped := gca.GetStats().(GenericChannelStats).Dropped
+	if assert.Equal(t, 1, dropped, "Dropped does not work, expect %d but got %d %s",
+		1, dropped, ballotX) {
+		t.Logf("Dropped works, expected %d %s", dropped, checkMark)
+	}
+}
+
+func TestGenericChannelAspectMethods(t *testing.T) {
+	gca := NewGenericChannelAspect("foo")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			gca.Observe("dist", float64(i))
+			gca.Inc("count")
+			gca.Set("gauge", 5)
+			gca.Time("time")()
+		}(i)
+	}
+	wg.Wait()
+	gca.calculate()
+
+	for name, expect := range map[string]string{"dist": "distribution", "count": "counter", "gauge": "gauge", "time": "distribution"} {
+		gcd := gca.Gcd[name]
+		if assert.Equal(t, expect, gcd.Kind, "Kind of %s does not work, expect %s but got %s %s",
+			name, expect, gcd.Kind, ballotX) {
+			t.Logf("Kind of %s works, expected %s %s", name, gcd.Kind, checkMark)
+		}
+		if assert.Equal(t, 10, gcd.Count, "Count of %s does not work, expect %d but got %d %s",
+			name, 10, gcd.Count, ballotX) {
+			t.Logf("Count of %s works, expected %d %s", name, gcd.Count, checkMark)
+		}
+	}
+	if assert.Equal(t, 10.0, gca.Gcd["count"].Value, "Inc does not work, expect %v but got %v %s",
+		10.0, gca.Gcd["count"].Value, ballotX) {
+		t.Logf("Inc works %s", checkMark)
+	}
+	if assert.Equal(t, 5.0, gca.Gcd["gauge"].Value, "Set does not work, expect %v but got %v %s",
+		5.0, gca.Gcd["gauge"].Value, ballotX) {
+		t.Logf("Set works %s", checkMark)
+	}
+	if assert.Equal(t, 4.5, gca.Gcd["dist"].Mean, "Observe does not work, expect %v but got %v %s",
+		4.5, gca.Gcd["dist"].Mean, ballotX) {
+		t.Logf("Observe works %s", checkMark)
+	}
+}
+
+func BenchmarkGenericChannelAspectObserveParallel(b *testing.B) {
+	gca := NewGenericChannelAspect("foo")
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			gca.Observe("bar", 1)
+		}
+	})
+}
+
+func BenchmarkGenericChannelAspectChannelParallel(b *testing.B) {
+	gca := NewGenericChannelAspect("foo")
+	ch := gca.SetupGenericChannelAspect()
+	defer gca.Close()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ch <- DataChannel{Name: "bar", Value: 1}
+		}
+	})
+}
+
+func BenchmarkGenericChannelAspectBufferedChannelParallel(b *testing.B) {
+	gca := NewGenericChannelAspect("foo")
+	ch := gca.SetupBufferedGenericChannelAspect(1000)
+	defer gca.Close()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ch <- DataChannel{Name: "bar", Value: 1}
+		}
+	})
+}
+
+func TestGenericChannelAspectTTL(t *testing.T) {
+	gca := NewGenericChannelAspect("foo")
+	gca.SetTTL(time.Millisecond)
+	gca.Register("registered", KindCounter)
+	gca.Observe("stale", 1)
+	gca.Observe("fresh", 1)
+	gca.calculate()
+
+	time.Sleep(5 * time.Millisecond)
+	gca.Observe("fresh", 1)
+	gca.calculate()
+
+	_, ok := gca.Gcd["stale"]
+	if assert.False(t, ok, "Stale name should be removed from Gcd %s", ballotX) {
+		t.Logf("Stale name was removed from Gcd %s", checkMark)
+	}
+	_, ok = gca.tempStore.data["stale"]
+	if assert.False(t, ok, "Stale name should be removed from tempStore %s", ballotX) {
+		t.Logf("Stale name was removed from tempStore %s", checkMark)
+	}
+	if assert.Equal(t, 1, gca.Gcd["fresh"].Count, "Fresh name should be kept %s", ballotX) {
+		t.Logf("Fresh name was kept %s", checkMark)
+	}
+	if assert.Equal(t, 2, gca.frame.Expired, "Expired does not work, expect %d but got %d %s",
+		2, gca.frame.Expired, ballotX) {
+		t.Logf("Expired works, expected %d %s", gca.frame.Expired, checkMark)
+	}
+
+	gca.Observe("registered", 3)
+	gca.calculate()
+	if assert.Equal(t, "counter", gca.Gcd["registered"].Kind, "Registered kind should survive expiry %s", ballotX) {
+		t.Logf("Registered kind survived expiry %s", checkMark)
+	}
+}
+
+func TestGenericChannelAspectMaxKeys(t *testing.T) {
+	gca := NewGenericChannelAspect("foo")
+	gca.SetMaxKeys(2, EvictLeastRecentlyUsed)
+	gca.Observe("a", 1)
+	gca.Observe("b", 1)
+	gca.calculate()
+	gca.Observe("a", 1)
+	gca.Observe("c", 1)
+	gca.calculate()
+
+	_, ok := gca.Gcd["b"]
+	if assert.False(t, ok, "Least recently used name should be evicted %s", ballotX) {
+		t.Logf("Least recently used name was evicted %s", checkMark)
+	}
+	for _, name := range []string{"a", "c"} {
+		if assert.Equal(t, 1, gca.Gcd[name].Count, "Name %s should be kept %s", name, ballotX) {
+			t.Logf("Name %s was kept %s", name, checkMark)
+		}
+	}
+	if assert.Equal(t, 1, gca.frame.Evicted, "Evicted does not work, expect %d but got %d %s",
+		1, gca.frame.Evicted, ballotX) {
+		t.Logf("Evicted works, expected %d %s", gca.frame.Evicted, checkMark)
+	}
+
+	gca.SetMaxKeys(2, RejectNewKeys)
+	gca.Observe("d", 1)
+	gca.Observe("a", 1)
+	gca.calculate()
+	_, ok = gca.Gcd["d"]
+	if assert.False(t, ok, "New name should be rejected %s", ballotX) {
+		t.Logf("New name was rejected %s", checkMark)
+	}
+	if assert.Equal(t, 1, gca.frame.Dropped, "Dropped does not work, expect %d but got %d %s",
+		1, gca.frame.Dropped, ballotX) {
+		t.Logf("Dropped works, expected %d %s", gca.frame.Dropped, checkMark)
+	}
+}
+
+func TestGenericChannelAspectSumAndRate(t *testing.T) {
+	gca := NewGenericChannelAspect("foo")
+	gca.windowStart = gca.windowStart.Add(-2 * time.Second)
+	for i := 1; i <= 10; i++ {
+		gca.Observe("dist", float64(i))
+		gca.add(DataChannel{Name: "count", Value: 3, Kind: KindCounter})
+	}
+	gca.calculate()
+
+	dist := gca.Gcd["dist"]
+	if assert.Equal(t, 55.0, dist.Sum, "Sum does not work, expect %v but got %v %s",
+		55.0, dist.Sum, ballotX) {
+		t.Logf("Sum works, expected %v %s", dist.Sum, checkMark)
+	}
+	if assert.InEpsilon(t, 2.0, dist.WindowSeconds, 0.01, "WindowSeconds does not work, expect %v but got %v %s",
+		2.0, dist.WindowSeconds, ballotX) {
+		t.Logf("WindowSeconds works, expected %v %s", dist.WindowSeconds, checkMark)
+	}
+	if assert.InEpsilon(t, 5.0, dist.RatePerSecond, 0.01, "RatePerSecond does not work, expect %v but got %v %s",
+		5.0, dist.RatePerSecond, ballotX) {
+		t.Logf("RatePerSecond works, expected %v %s", dist.RatePerSecond, checkMark)
+	}
+
+	count := gca.Gcd["count"]
+	if assert.InEpsilon(t, 15.0, count.RatePerSecond, 0.01, "RatePerSecond of a counter does not work, expect %v but got %v %s",
+		15.0, count.RatePerSecond, ballotX) {
+		t.Logf("RatePerSecond of a counter works, expected %v %s", count.RatePerSecond, checkMark)
+	}
+}
+
+func TestGenericChannelAspectSingleObservation(t *testing.T) {
+	gca := NewGenericChannelAspect("single")
+	gca.Observe("rare", 42)
+	gca.calculate()
+	d := gca.GetStats().(GenericChannelStats).Metrics["rare"]
+	if assert.Equal(t, 0.0, d.Stdev, "Stdev of one observation should be 0, but got %v %s", d.Stdev, ballotX) {
+		t.Logf("Stdev of one observation is 0 %s", checkMark)
+	}
+	_, err := json.Marshal(gca.GetStats())
+	if assert.NoError(t, err, "Stats of one observation should be encoded %s", ballotX) {
+		t.Logf("Stats of one observation are encoded %s", checkMark)
+	}
+}
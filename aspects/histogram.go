@@ -0,0 +1,267 @@
+package ginmon
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// DefaultRelativeError is the relative error of quantiles calculated
+// by histograms of aspects, if not configured otherwise.
+const DefaultRelativeError = 0.01
+
+// ErrIncompatibleHistograms is returned by Merge, if the histograms
+// were created with different relative errors.
+var ErrIncompatibleHistograms = errors.New("histograms have different relative errors")
+
+// ErrNoHistograms is returned by Merge, if there is nothing to merge.
+var ErrNoHistograms = errors.New("no histograms to merge")
+
+// Histogram is a mergeable state of a distribution, that can be
+// exposed as JSON. Values are counted in buckets with exponentially
+// growing bounds, such that quantiles have a relative error of at most
+// RelativeError. Histograms of many instances can be combined with
+// Merge to calculate statistics of all of them.
+type Histogram struct {
+	RelativeError float64     `json:"relative_error"`
+	Count         int         `json:"count"`
+	Sum           float64     `json:"sum"`
+	SumOfSquares  float64     `json:"sum_of_squares"`
+	Min           float64     `json:"min"`
+	Max           float64     `json:"max"`
+	Zero          int         `json:"zero"`
+	Positive      map[int]int `json:"positive"`
+	Negative      map[int]int `json:"negative"`
+}
+
+// NewHistogram returns a new initialized Histogram with the given
+// relative error, that has to be in (0,1). Other values are replaced
+// by DefaultRelativeError.
+func NewHistogram(relativeError float64) *Histogram {
+	if !(relativeError > 0 && relativeError < 1) {
+		relativeError = DefaultRelativeError
+	}
+	return &Histogram{
+		RelativeError: relativeError,
+		Positive:      make(map[int]int),
+		Negative:      make(map[int]int),
+	}
+}
+
+// gamma is the ratio between the upper and lower bound of a bucket.
+func (h *Histogram) gamma() float64 {
+	return (1 + h.RelativeError) / (1 - h.RelativeError)
+}
+
+// index returns the bucket of v > 0, bucket i contains values in
+// (gamma^(i-1), gamma^i].
+func (h *Histogram) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(h.gamma())))
+}
+
+// value returns the estimated value of all values in bucket i.
+func (h *Histogram) value(i int) float64 {
+	g := h.gamma()
+	return 2 * math.Pow(g, float64(i)) / (g + 1)
+}
+
+// Add counts v in the histogram.
+func (h *Histogram) Add(v float64) {
+	if h.Count == 0 || v < h.Min {
+		h.Min = v
+	}
+	if h.Count == 0 || v > h.Max {
+		h.Max = v
+	}
+	h.Count++
+	h.Sum += v
+	h.SumOfSquares += v * v
+
+	if h.Positive == nil {
+		h.Positive = make(map[int]int)
+	}
+	if h.Negative == nil {
+		h.Negative = make(map[int]int)
+	}
+	switch {
+	case v > 0:
+		h.Positive[h.index(v)]++
+	case v < 0:
+		h.Negative[h.index(-v)]++
+	default:
+		h.Zero++
+	}
+}
+
+// Quantile returns the estimated value at q \in [0,1]. Like the
+// percentiles of the aspects it returns the value at rank q*Count of
+// the ordered values.
+func (h *Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := int(q * float64(h.Count))
+	if rank >= h.Count {
+		rank = h.Count - 1
+	}
+
+	var v float64
+	seen := 0
+	found := false
+	// negative values from the lowest to the highest
+	for _, i := range sortedIndexes(h.Negative, true) {
+		seen += h.Negative[i]
+		if seen > rank {
+			v, found = -h.value(i), true
+			break
+		}
+	}
+	if !found {
+		seen += h.Zero
+		found = seen > rank
+	}
+	if !found {
+		for _, i := range sortedIndexes(h.Positive, false) {
+			seen += h.Positive[i]
+			if seen > rank {
+				v = h.value(i)
+				break
+			}
+		}
+	}
+
+	return math.Max(h.Min, math.Min(h.Max, v))
+}
+
+// Mean returns the mean of all values.
+func (h *Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Count)
+}
+
+// Stdev returns the corrected standard deviation of all values.
+func (h *Histogram) Stdev() float64 {
+	if h.Count < 2 {
+		return 0
+	}
+	n := float64(h.Count)
+	variance := (h.SumOfSquares - h.Sum*h.Sum/n) / (n - 1)
+	if variance < 0 {
+		return 0
+	}
+	return math.Sqrt(variance)
+}
+
+// Summary returns the statistics of the histogram in the same format
+// a GenericChannelAspect uses for distributions.
+func (h *Histogram) Summary() GenericChannelData {
+	return GenericChannelData{
+		Kind:  KindDistribution.String(),
+		Count: h.Count,
+		Sum:   h.Sum,
+		Min:   h.Min,
+		Max:   h.Max,
+		Mean:  h.Mean(),
+		Stdev: h.Stdev(),
+		P90:   h.Quantile(0.9),
+		P95:   h.Quantile(0.95),
+		P99:   h.Quantile(0.99),
+	}
+}
+
+// Bucket is a cumulative bucket of a Histogram, Count is the number of
+// values less than or equal to UpperBound.
+type Bucket struct {
+	UpperBound float64
+	Count      int
+}
+
+// Buckets returns the cumulative buckets of all counted values sorted
+// by UpperBound, like the buckets of OpenMetrics histograms. Empty
+// buckets are skipped, the last bucket has the UpperBound +Inf.
+func (h *Histogram) Buckets() []Bucket {
+	g := h.gamma()
+	buckets := make([]Bucket, 0, len(h.Negative)+len(h.Positive)+2)
+	seen := 0
+	// bucket i of negative values contains [-gamma^i, -gamma^(i-1))
+	for _, i := range sortedIndexes(h.Negative, true) {
+		seen += h.Negative[i]
+		buckets = append(buckets, Bucket{UpperBound: -math.Pow(g, float64(i-1)), Count: seen})
+	}
+	if h.Zero > 0 {
+		seen += h.Zero
+		buckets = append(buckets, Bucket{UpperBound: 0, Count: seen})
+	}
+	for _, i := range sortedIndexes(h.Positive, false) {
+		seen += h.Positive[i]
+		buckets = append(buckets, Bucket{UpperBound: math.Pow(g, float64(i)), Count: seen})
+	}
+	return append(buckets, Bucket{UpperBound: math.Inf(1), Count: seen})
+}
+
+// Merge returns a new Histogram that contains the values of all
+// given histograms, nil histograms are skipped. All histograms have
+// to use the same relative error.
+func Merge(histograms ...*Histogram) (*Histogram, error) {
+	var res *Histogram
+	for _, h := range histograms {
+		if h == nil {
+			continue
+		}
+		if res == nil {
+			res = NewHistogram(h.RelativeError)
+		}
+		if h.RelativeError != res.RelativeError {
+			return nil, ErrIncompatibleHistograms
+		}
+		if h.Count == 0 {
+			continue
+		}
+
+		if res.Count == 0 || h.Min < res.Min {
+			res.Min = h.Min
+		}
+		if res.Count == 0 || h.Max > res.Max {
+			res.Max = h.Max
+		}
+		res.Count += h.Count
+		res.Sum += h.Sum
+		res.SumOfSquares += h.SumOfSquares
+		res.Zero += h.Zero
+		for i, n := range h.Positive {
+			res.Positive[i] += n
+		}
+		for i, n := range h.Negative {
+			res.Negative[i] += n
+		}
+	}
+
+	if res == nil {
+		return nil, ErrNoHistograms
+	}
+	return res, nil
+}
+
+// newHistogramFrom returns a Histogram of the given observations.
+func newHistogramFrom(relativeError float64, observations []float64) *Histogram {
+	h := NewHistogram(relativeError)
+	for _, v := range observations {
+		h.Add(v)
+	}
+	return h
+}
+
+func sortedIndexes(buckets map[int]int, descending bool) []int {
+	indexes := make([]int, 0, len(buckets))
+	for i := range buckets {
+		indexes = append(indexes, i)
+	}
+	if descending {
+		sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+	} else {
+		sort.Ints(indexes)
+	}
+	return indexes
+}
@@ -0,0 +1,172 @@
+package ginmon
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	h := NewHistogram(DefaultRelativeError)
+	for i := 0; i <= 1000; i++ {
+		h.Add(float64(i))
+	}
+
+	if assert.Equal(t, 1001, h.Count, "Count does not work, expect %d but got %d %s",
+		1001, h.Count, ballotX) {
+		t.Logf("Count works, expected %d %s", h.Count, checkMark)
+	}
+	if assert.Equal(t, 0.0, h.Quantile(0), "Quantile(0) does not work, expect %v but got %v %s",
+		0.0, h.Quantile(0), ballotX) {
+		t.Logf("Quantile(0) works %s", checkMark)
+	}
+	if assert.Equal(t, 1000.0, h.Quantile(1), "Quantile(1) does not work, expect %v but got %v %s",
+		1000.0, h.Quantile(1), ballotX) {
+		t.Logf("Quantile(1) works %s", checkMark)
+	}
+	for q, expect := range map[float64]float64{0.5: 500, 0.9: 900, 0.99: 990} {
+		if assert.InEpsilon(t, expect, h.Quantile(q), DefaultRelativeError, "Quantile(%v) does not work, expect %v but got %v %s",
+			q, expect, h.Quantile(q), ballotX) {
+			t.Logf("Quantile(%v) works, expected %v %s", q, h.Quantile(q), checkMark)
+		}
+	}
+	if assert.InEpsilon(t, 289.1, h.Stdev(), 0.01, "Stdev does not work, expect %v but got %v %s",
+		289.1, h.Stdev(), ballotX) {
+		t.Logf("Stdev works, expected %v %s", h.Stdev(), checkMark)
+	}
+}
+
+func TestHistogramNegative(t *testing.T) {
+	h := NewHistogram(DefaultRelativeError)
+	for i := -50; i < 50; i++ {
+		h.Add(float64(i))
+	}
+
+	if assert.InEpsilon(t, -40.0, h.Quantile(0.1), DefaultRelativeError, "Quantile(0.1) does not work, expect %v but got %v %s",
+		-40.0, h.Quantile(0.1), ballotX) {
+		t.Logf("Quantile(0.1) works %s", checkMark)
+	}
+	if assert.Equal(t, 0.0, h.Quantile(0.5), "Quantile(0.5) does not work, expect %v but got %v %s",
+		0.0, h.Quantile(0.5), ballotX) {
+		t.Logf("Quantile(0.5) works %s", checkMark)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	var snapshots [][]byte
+	for j := 0; j < 4; j++ {
+		h := NewHistogram(DefaultRelativeError)
+		for i := 0; i < 250; i++ {
+			h.Add(float64(j*250 + i))
+		}
+		b, err := json.Marshal(h)
+		if !assert.NoError(t, err, "Marshal does not work %s", ballotX) {
+			return
+		}
+		snapshots = append(snapshots, b)
+	}
+
+	var histograms []*Histogram
+	for _, b := range snapshots {
+		var h Histogram
+		if !assert.NoError(t, json.Unmarshal(b, &h), "Unmarshal does not work %s", ballotX) {
+			return
+		}
+		histograms = append(histograms, &h)
+	}
+
+	merged, err := Merge(append(histograms, nil)...)
+	if !assert.NoError(t, err, "Merge does not work %s", ballotX) {
+		return
+	}
+	summary := merged.Summary()
+	if assert.Equal(t, 1000, summary.Count, "Count does not work, expect %d but got %d %s",
+		1000, summary.Count, ballotX) {
+		t.Logf("Count works, expected %d %s", summary.Count, checkMark)
+	}
+	if assert.Equal(t, 999.0, summary.Max, "Max does not work, expect %v but got %v %s",
+		999.0, summary.Max, ballotX) {
+		t.Logf("Max works, expected %v %s", summary.Max, checkMark)
+	}
+	if assert.Equal(t, 499.5, summary.Mean, "Mean does not work, expect %v but got %v %s",
+		499.5, summary.Mean, ballotX) {
+		t.Logf("Mean works, expected %v %s", summary.Mean, checkMark)
+	}
+	if assert.InEpsilon(t, 990.0, summary.P99, DefaultRelativeError, "P99 does not work, expect %v but got %v %s",
+		990.0, summary.P99, ballotX) {
+		t.Logf("P99 works, expected %v %s", summary.P99, checkMark)
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	_, err := Merge()
+	if assert.Equal(t, ErrNoHistograms, err, "Merge without histograms should fail %s", ballotX) {
+		t.Logf("Merge without histograms fails %s", checkMark)
+	}
+	_, err = Merge(NewHistogram(0.01), NewHistogram(0.02))
+	if assert.Equal(t, ErrIncompatibleHistograms, err, "Merge of incompatible histograms should fail %s", ballotX) {
+		t.Logf("Merge of incompatible histograms fails %s", checkMark)
+	}
+	for _, e := range []float64{0, -0.5, 1, 2, math.NaN()} {
+		if h := NewHistogram(e); assert.Equal(t, DefaultRelativeError, h.RelativeError, "NewHistogram(%v) should use DefaultRelativeError %s", e, ballotX) {
+			t.Logf("NewHistogram(%v) uses DefaultRelativeError %s", e, checkMark)
+		}
+	}
+	_, err = Merge(&Histogram{RelativeError: 2, Count: 1})
+	if assert.Equal(t, ErrIncompatibleHistograms, err, "Merge of invalid histograms should fail %s", ballotX) {
+		t.Logf("Merge of invalid histograms fails %s", checkMark)
+	}
+}
+
+func TestHistogramAspects(t *testing.T) {
+	gca := NewGenericChannelAspect("foo")
+	gca.EnableHistograms(DefaultRelativeError)
+	gca.Observe("dist", 1)
+	gca.Inc("count")
+	gca.calculate()
+	if assert.NotNil(t, gca.Gcd["dist"].Histogram, "Distribution should have a histogram %s", ballotX) {
+		t.Logf("Distribution has a histogram %s", checkMark)
+	}
+	stats := gca.GetStats().(GenericChannelStats).Metrics
+	if assert.Equal(t, 1, stats["dist"].Histogram.Count, "GetStats should copy the histogram %s", ballotX) {
+		t.Logf("GetStats copies the histogram %s", checkMark)
+	}
+	if assert.Nil(t, gca.Gcd["count"].Histogram, "Counter should not have a histogram %s", ballotX) {
+		t.Logf("Counter has no histogram %s", checkMark)
+	}
+
+	rt := NewRequestTimeAspect()
+	rt.EnableHistogram(DefaultRelativeError)
+	rt.createValues(100)
+	rt.calculate()
+	if assert.NotNil(t, rt.Histogram, "RequestTimeAspect should have a histogram %s", ballotX) {
+		t.Logf("RequestTimeAspect has a histogram %s", checkMark)
+	}
+	if assert.Equal(t, rt.Count, rt.Histogram.Count, "Count of histogram does not work, expect %d but got %d %s",
+		rt.Count, rt.Histogram.Count, ballotX) {
+		t.Logf("Count of histogram works %s", checkMark)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	h := NewHistogram(DefaultRelativeError)
+	for _, v := range []float64{-2, 0, 1, 1, 100} {
+		h.Add(v)
+	}
+	buckets := h.Buckets()
+	counts := make([]int, len(buckets))
+	for i, b := range buckets {
+		counts[i] = b.Count
+		if i > 0 && !assert.True(t, b.UpperBound > buckets[i-1].UpperBound, "Buckets should be sorted %s", ballotX) {
+			return
+		}
+	}
+	expect := []int{1, 2, 4, 5, 5}
+	if assert.Equal(t, expect, counts, "Buckets do not work, expect %v but got %v %s", expect, counts, ballotX) &&
+		assert.True(t, math.IsInf(buckets[len(buckets)-1].UpperBound, 1)) && assert.True(t, buckets[0].UpperBound >= -2) &&
+		assert.True(t, buckets[2].UpperBound >= 1) && assert.True(t, buckets[3].UpperBound >= 100) {
+		t.Logf("Buckets work, expected %v %s", counts, checkMark)
+	}
+}
@@ -0,0 +1,85 @@
+package ginmon
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricsKey is the key of the metricsRecorder in the gin.Context.
+const metricsKey = "ginmon.metrics"
+
+// TaggedName returns the name of a value observed by Observe in a
+// request with the given route and status code, like
+// items{route="/users/:id",status="200"}.
+func TaggedName(name, route string, status int) string {
+	return name + `{route="` + route + `",status="` + strconv.Itoa(status) + `"}`
+}
+
+// MetricsHandler is a middleware function to use in Gin, it collects
+// the values of Observe and ObserveKind in a request and adds them to
+// gc after the request, if it passes all filters. Names are tagged
+// with route and status by TaggedName, the trace ID of a W3C
+// traceparent header is kept as exemplar.
+//
+// Example:
+//    	router.Use(ginmon.MetricsHandler(gc))
+//    	router.GET("/items", func(c *gin.Context) {
+//    		items := listItems()
+//    		ginmon.Observe(c, "items", float64(len(items)))
+//    		c.JSON(http.StatusOK, items)
+//    	})
+func MetricsHandler(gc *GenericChannelAspect, filters ...Filter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mr := &metricsRecorder{}
+		c.Set(metricsKey, mr)
+		c.Next()
+		if !record(c, filters) {
+			return
+		}
+		r, status := route(c), c.Writer.Status()
+		trace := traceID(c.Request, DefaultTraceIDHeader)
+		for _, dc := range mr.result() {
+			dc.Name = TaggedName(dc.Name, r, status)
+			dc.TraceID = trace
+			gc.add(dc)
+		}
+	}
+}
+
+// Observe adds value to name of the request, aggregated by the kind
+// registered for the tagged name. Without MetricsHandler it does
+// nothing.
+func Observe(c *gin.Context, name string, value float64) {
+	ObserveKind(c, name, value, KindDefault)
+}
+
+// ObserveKind adds value to name of the request, aggregated by kind.
+// Without MetricsHandler it does nothing.
+func ObserveKind(c *gin.Context, name string, value float64, kind MetricKind) {
+	v, ok := c.Get(metricsKey)
+	if !ok {
+		return
+	}
+	v.(*metricsRecorder).add(DataChannel{Name: name, Value: value, Kind: kind})
+}
+
+// metricsRecorder collects the values of one request, they can be
+// added by other goroutines.
+type metricsRecorder struct {
+	sync.Mutex
+	values []DataChannel
+}
+
+func (mr *metricsRecorder) add(dc DataChannel) {
+	mr.Lock()
+	defer mr.Unlock()
+	mr.values = append(mr.values, dc)
+}
+
+func (mr *metricsRecorder) result() []DataChannel {
+	mr.Lock()
+	defer mr.Unlock()
+	return mr.values
+}
@@ -0,0 +1,51 @@
+package ginmon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MetricsHandler(t *testing.T) {
+	gin.SetMode(TestMode)
+	gca := NewGenericChannelAspect("Handlers")
+	router := gin.New()
+	router.Use(MetricsHandler(gca, Exclude(Path("/healthz"))))
+	router.GET("/items/:kind", func(c *gin.Context) {
+		Observe(c, "items", 3)
+		ObserveKind(c, "cache_hits", 1, KindCounter)
+		if c.Param("kind") == "missing" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	router.GET("/healthz", func(c *gin.Context) {
+		Observe(c, "items", 1)
+	})
+
+	for _, path := range []string{"/items/a", "/items/b", "/items/missing", "/healthz"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	gca.calculate()
+	stats := gca.GetStats().(GenericChannelStats).Metrics
+
+	ok := TaggedName("items", "/items/:kind", http.StatusOK)
+	if assert.Equal(t, 2, stats[ok].Count, "Observe does not work, expect %d but got %d %s", 2, stats[ok].Count, ballotX) {
+		t.Logf("Observe works, expected %d %s", stats[ok].Count, checkMark)
+	}
+	hits := stats[TaggedName("cache_hits", "/items/:kind", http.StatusNotFound)]
+	if assert.Equal(t, KindCounter.String(), hits.Kind) &&
+		assert.Equal(t, 1.0, hits.Value, "ObserveKind does not work, expect %v but got %v %s", 1.0, hits.Value, ballotX) {
+		t.Logf("ObserveKind works, expected %v %s", hits.Value, checkMark)
+	}
+	if assert.NotContains(t, stats, TaggedName("items", "/healthz", http.StatusOK), "Filter does not work %s", ballotX) {
+		t.Logf("Filter works %s", checkMark)
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	assert.NotPanics(t, func() { Observe(c, "items", 1) }, "Observe without MetricsHandler does not work %s", ballotX)
+}
@@ -0,0 +1,285 @@
+package ginmon
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// TotalPhase is the phase that measures the whole request.
+	TotalPhase = "total"
+	// UnmatchedRoute is the route of requests that did not match a
+	// route of the gin.Engine.
+	UnmatchedRoute = "unmatched"
+)
+
+// phaseKey is the key of the phaseRecorder in the gin.Context.
+const phaseKey = "ginmon.phases"
+
+// PhaseStats are the calculated durations of all phases by route and
+// phase, measured in nanoseconds.
+type PhaseStats struct {
+	Routes        map[string]map[string]GenericChannelData `json:"routes"`
+	WindowSeconds float64                                  `json:"window_seconds"`
+	Timestamp     time.Time                                `json:"timestamp"`
+}
+
+// PhaseAspect records the phases marked by Phase in requests handled
+// by PhaseHandler.
+//
+// Example:
+//    	phaseAspect := ginmon.NewPhaseAspect("Phases")
+//    	phaseAspect.EnableServerTiming()
+//    	phaseAspect.StartTimer(time.Minute)
+//    	router.Use(ginmon.PhaseHandler(phaseAspect))
+type PhaseAspect struct {
+	lock         sync.RWMutex
+	name         string
+	serverTiming bool
+	windows      map[string]map[string][]float64 // guarded by lock
+	windowStart  time.Time
+	Stats        PhaseStats
+}
+
+// NewPhaseAspect returns a new initialized PhaseAspect, that is served
+// as name.
+func NewPhaseAspect(name string) *PhaseAspect {
+	return &PhaseAspect{
+		name:        name,
+		windows:     make(map[string]map[string][]float64),
+		windowStart: time.Now(),
+		Stats:       PhaseStats{Routes: make(map[string]map[string]GenericChannelData)},
+	}
+}
+
+// EnableServerTiming sends the phases finished before the response
+// headers as W3C Server-Timing header, such that they are shown by
+// browser devtools. It has to be called before PhaseHandler is used.
+func (pa *PhaseAspect) EnableServerTiming() {
+	pa.serverTiming = true
+}
+
+// StartTimer will call a forever loop in a goroutine to calculate
+// metrics for measurements every d ticks.
+func (pa *PhaseAspect) StartTimer(d time.Duration) {
+	timer := time.Tick(d)
+	go func() {
+		for {
+			<-timer
+			pa.calculate()
+		}
+	}()
+}
+
+// GetStats to fulfill aspects.Aspect interface, it returns the data
+// that will be served as JSON.
+func (pa *PhaseAspect) GetStats() interface{} {
+	pa.lock.RLock()
+	defer pa.lock.RUnlock()
+	return pa.Stats
+}
+
+// Name to fulfill aspects.Aspect interface, it will return the name
+// of the JSON object that will be served.
+func (pa *PhaseAspect) Name() string {
+	return pa.name
+}
+
+// InRoot to fulfill aspects.Aspect interface, it will return where to
+// put the JSON object into the monitoring endpoint.
+func (pa *PhaseAspect) InRoot() bool {
+	return false
+}
+
+// PhaseHandler is a middleware function to use in Gin, it records the
+// phases of requests, that pass all filters. Phases are recorded by
+// route, the path pattern of the gin.Engine, and TotalPhase is added.
+func PhaseHandler(pa *PhaseAspect, filters ...Filter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pr := &phaseRecorder{start: time.Now(), phases: make(map[string]time.Duration)}
+		c.Set(phaseKey, pr)
+		var stw *serverTimingWriter
+		if pa.serverTiming {
+			stw = &serverTimingWriter{ResponseWriter: c.Writer, pr: pr}
+			c.Writer = stw
+		}
+
+		c.Next()
+		if stw != nil {
+			// handlers without body did not write the headers yet
+			stw.setHeader()
+			c.Writer = stw.ResponseWriter
+		}
+		total := time.Since(pr.start)
+		if !record(c, filters) {
+			return
+		}
+		pa.add(route(c), pr.result(), total)
+	}
+}
+
+// Phase starts the phase name of the request and returns a function
+// that ends it. Phases with the same name are summed up. Without
+// PhaseHandler it does nothing. Names should be tokens as defined by
+// RFC 7230, if they are sent as Server-Timing header.
+//
+// Example:
+//    	defer ginmon.Phase(c, "db")()
+func Phase(c *gin.Context, name string) func() {
+	v, ok := c.Get(phaseKey)
+	if !ok {
+		return func() {}
+	}
+	pr := v.(*phaseRecorder)
+	start := time.Now()
+	return func() {
+		pr.add(name, time.Since(start))
+	}
+}
+
+// route returns the path pattern of the gin.Engine that matched c,
+// which has a bounded number of values unlike the path.
+func route(c *gin.Context) string {
+	if r := c.FullPath(); r != "" {
+		return r
+	}
+	return UnmatchedRoute
+}
+
+// phaseRecorder collects the phases of one request, phases can be
+// ended by other goroutines.
+type phaseRecorder struct {
+	sync.Mutex
+	start  time.Time
+	order  []string
+	phases map[string]time.Duration
+}
+
+func (pr *phaseRecorder) add(name string, d time.Duration) {
+	pr.Lock()
+	defer pr.Unlock()
+	if _, ok := pr.phases[name]; !ok {
+		pr.order = append(pr.order, name)
+	}
+	pr.phases[name] += d
+}
+
+// result returns a copy of the phases.
+func (pr *phaseRecorder) result() map[string]time.Duration {
+	pr.Lock()
+	defer pr.Unlock()
+	res := make(map[string]time.Duration, len(pr.phases))
+	for name, d := range pr.phases {
+		res[name] = d
+	}
+	return res
+}
+
+// serverTiming returns the Server-Timing header value of the phases
+// finished so far, durations are in milliseconds.
+func (pr *phaseRecorder) serverTiming() string {
+	pr.Lock()
+	defer pr.Unlock()
+	metrics := make([]string, 0, len(pr.order)+1)
+	for _, name := range pr.order {
+		metrics = append(metrics, fmt.Sprintf("%s;dur=%.3f", name, milliseconds(pr.phases[name])))
+	}
+	metrics = append(metrics, fmt.Sprintf("%s;dur=%.3f", TotalPhase, milliseconds(time.Since(pr.start))))
+	return strings.Join(metrics, ", ")
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// serverTimingWriter sets the Server-Timing header before the headers
+// are written.
+type serverTimingWriter struct {
+	gin.ResponseWriter
+	pr   *phaseRecorder
+	done bool
+}
+
+func (w *serverTimingWriter) setHeader() {
+	if w.done {
+		return
+	}
+	w.done = true
+	if !w.ResponseWriter.Written() {
+		w.Header().Set("Server-Timing", w.pr.serverTiming())
+	}
+}
+
+func (w *serverTimingWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *serverTimingWriter) Write(data []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *serverTimingWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *serverTimingWriter) Flush() {
+	w.setHeader()
+	w.ResponseWriter.Flush()
+}
+
+// add records the phases of one request.
+func (pa *PhaseAspect) add(route string, phases map[string]time.Duration, total time.Duration) {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+	w, ok := pa.windows[route]
+	if !ok {
+		w = make(map[string][]float64)
+		pa.windows[route] = w
+	}
+	for name, d := range phases {
+		w[name] = append(w[name], float64(d))
+	}
+	w[TotalPhase] = append(w[TotalPhase], float64(total))
+}
+
+// calculate swaps the collected phases under lock and aggregates them
+// afterwards.
+func (pa *PhaseAspect) calculate() {
+	now := time.Now()
+	window := now.Sub(pa.windowStart)
+	pa.windowStart = now
+
+	pa.lock.Lock()
+	windows := pa.windows
+	pa.windows = make(map[string]map[string][]float64, len(windows))
+	pa.lock.Unlock()
+
+	stats := PhaseStats{
+		Routes:        make(map[string]map[string]GenericChannelData, len(windows)),
+		WindowSeconds: window.Seconds(),
+		Timestamp:     now,
+	}
+	for route, phases := range windows {
+		res := make(map[string]GenericChannelData, len(phases))
+		for name, durations := range phases {
+			d := distributionData(durations)
+			d.Kind = KindDistribution.String()
+			d.WindowSeconds = window.Seconds()
+			d.RatePerSecond = perSecond(float64(d.Count), window)
+			d.Timestamp = now
+			res[name] = d
+		}
+		stats.Routes[route] = res
+	}
+
+	pa.lock.Lock()
+	pa.Stats = stats
+	pa.lock.Unlock()
+}
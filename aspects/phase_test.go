@@ -0,0 +1,84 @@
+package ginmon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PhaseHandler(t *testing.T) {
+	gin.SetMode(TestMode)
+	pa := NewPhaseAspect("Phases")
+	pa.EnableServerTiming()
+	router := gin.New()
+	router.Use(PhaseHandler(pa, Exclude(Path("/healthz"))))
+	router.GET("/users/:id", func(c *gin.Context) {
+		for i := 0; i < 2; i++ {
+			stop := Phase(c, "db")
+			time.Sleep(time.Millisecond)
+			stop()
+		}
+		Phase(c, "render")()
+		c.String(http.StatusOK, "ok")
+	})
+	router.GET("/empty", func(c *gin.Context) {
+		Phase(c, "db")()
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/healthz", func(c *gin.Context) {})
+
+	var header string
+	for _, path := range []string{"/users/1", "/users/2", "/empty", "/missing", "/healthz"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if path == "/users/1" {
+			header = w.Header().Get("Server-Timing")
+		}
+		if path == "/empty" {
+			assert.Contains(t, w.Header().Get("Server-Timing"), "db;dur=", "Server-Timing without body does not work %s", ballotX)
+		}
+	}
+	expect := regexp.MustCompile(`^db;dur=\d+\.\d{3}, render;dur=\d+\.\d{3}, total;dur=\d+\.\d{3}$`)
+	if assert.Regexp(t, expect, header, "Server-Timing does not work, got %q %s", header, ballotX) {
+		t.Logf("Server-Timing works, got %q %s", header, checkMark)
+	}
+
+	pa.calculate()
+	stats := pa.GetStats().(PhaseStats)
+	db := stats.Routes["/users/:id"]["db"]
+	if assert.Equal(t, 2, db.Count, "Phase does not work, expect %d but got %d %s", 2, db.Count, ballotX) &&
+		assert.True(t, db.Min >= float64(2*time.Millisecond), "Phases with the same name are not summed up %s", ballotX) {
+		t.Logf("Phase works, expected %d %s", db.Count, checkMark)
+	}
+	if assert.Equal(t, 1, stats.Routes[UnmatchedRoute][TotalPhase].Count, "Unmatched route does not work %s", ballotX) {
+		t.Logf("Unmatched route works %s", checkMark)
+	}
+	if assert.NotContains(t, stats.Routes, "/healthz", "Filter does not work %s", ballotX) {
+		t.Logf("Filter works %s", checkMark)
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	assert.NotPanics(t, func() { Phase(c, "db")() }, "Phase without PhaseHandler does not work %s", ballotX)
+}
+
+func Test_PhaseHandlerSingleRequest(t *testing.T) {
+	gin.SetMode(TestMode)
+	pa := NewPhaseAspect("Phases")
+	router := gin.New()
+	router.Use(PhaseHandler(pa))
+	router.GET("/", func(c *gin.Context) {
+		Phase(c, "db")()
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	pa.calculate()
+	_, err := json.Marshal(pa.GetStats())
+	if assert.NoError(t, err, "Stats of one request should be encoded %s", ballotX) {
+		t.Logf("Stats of one request are encoded %s", checkMark)
+	}
+}
@@ -0,0 +1,317 @@
+package ginmon
+
+import (
+	"bufio"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc/self/stat,
+// which is 100 on all Linux platforms supported by Go.
+const clockTicks = 100
+
+// ProcessStats are the resources used by the process and the limits
+// of its container. Values that can not be read are 0 and omitted.
+// CPUUtilization is the number of CPU cores used in the time frame.
+// OpenFDs does not count the fd opened to read them.
+type ProcessStats struct {
+	CPUSeconds         float64   `json:"cpu_seconds"`
+	CPUUtilization     float64   `json:"cpu_utilization"`
+	CPULimitCores      float64   `json:"cpu_limit_cores,omitempty"`
+	CPULimitPercent    float64   `json:"cpu_limit_percent,omitempty"`
+	RSSBytes           uint64    `json:"rss_bytes,omitempty"`
+	Threads            int       `json:"threads,omitempty"`
+	OpenFDs            int       `json:"open_fds,omitempty"`
+	MaxFDs             uint64    `json:"max_fds,omitempty"`
+	MemoryUsageBytes   uint64    `json:"memory_usage_bytes,omitempty"`
+	MemoryLimitBytes   uint64    `json:"memory_limit_bytes,omitempty"`
+	MemoryLimitPercent float64   `json:"memory_limit_percent,omitempty"`
+	CgroupVersion      int       `json:"cgroup_version,omitempty"`
+	WindowSeconds      float64   `json:"window_seconds"`
+	Timestamp          time.Time `json:"timestamp"`
+}
+
+// ProcessAspect exposes CPU, memory, threads and file descriptors of
+// the process from /proc/self and the CPU and memory limits of its
+// cgroup (v1 or v2) from /sys/fs/cgroup. Missing files are skipped,
+// such that it can be used on every platform.
+type ProcessAspect struct {
+	lock        sync.RWMutex
+	procDir     string
+	cgroupDir   string
+	prevCPU     float64
+	windowStart time.Time
+	Stats       ProcessStats
+}
+
+// NewProcessAspect returns a new initialized ProcessAspect for the
+// current process.
+func NewProcessAspect() *ProcessAspect {
+	return NewProcessAspectFrom("/proc/self", "/sys/fs/cgroup")
+}
+
+// NewProcessAspectFrom returns a new initialized ProcessAspect, that
+// reads the files of procDir, like /proc/self, and cgroupDir, like
+// /sys/fs/cgroup.
+func NewProcessAspectFrom(procDir, cgroupDir string) *ProcessAspect {
+	pa := &ProcessAspect{procDir: procDir, cgroupDir: cgroupDir}
+	pa.prevCPU, _ = pa.cpuSeconds()
+	pa.windowStart = time.Now()
+	return pa
+}
+
+// StartTimer will call a forever loop in a goroutine to calculate
+// metrics for measurements every d ticks.
+func (pa *ProcessAspect) StartTimer(d time.Duration) {
+	timer := time.Tick(d)
+	go func() {
+		for {
+			<-timer
+			pa.calculate(time.Now())
+		}
+	}()
+}
+
+// GetStats to fulfill aspects.Aspect interface, it returns the data
+// that will be served as JSON.
+func (pa *ProcessAspect) GetStats() interface{} {
+	pa.lock.RLock()
+	defer pa.lock.RUnlock()
+	return pa.Stats
+}
+
+// Name to fulfill aspects.Aspect interface, it will return the name
+// of the JSON object that will be served.
+func (pa *ProcessAspect) Name() string {
+	return "Process"
+}
+
+// InRoot to fulfill aspects.Aspect interface, it will return where to
+// put the JSON object into the monitoring endpoint.
+func (pa *ProcessAspect) InRoot() bool {
+	return false
+}
+
+// countFDs returns the number of entries of dir, like /proc/self/fd.
+// Reading the directory opens a fd, that is listed in it as well, it
+// is not counted.
+func countFDs(dir string) int {
+	f, err := os.Open(dir)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0
+	}
+	n := len(names)
+	own := strconv.Itoa(int(f.Fd()))
+	for _, name := range names {
+		if name != own {
+			continue
+		}
+		dirInfo, err := f.Stat()
+		if err != nil {
+			break
+		}
+		if fi, err := os.Stat(filepath.Join(dir, name)); err == nil && os.SameFile(dirInfo, fi) {
+			n--
+		}
+	}
+	return n
+}
+
+func (pa *ProcessAspect) calculate(now time.Time) {
+	window := now.Sub(pa.windowStart)
+	pa.windowStart = now
+	s := ProcessStats{WindowSeconds: window.Seconds(), Timestamp: now}
+
+	if cpu, ok := pa.cpuSeconds(); ok {
+		s.CPUSeconds = cpu
+		if window > 0 {
+			s.CPUUtilization = (cpu - pa.prevCPU) / window.Seconds()
+		}
+		pa.prevCPU = cpu
+	}
+	status := readKeyValues(filepath.Join(pa.procDir, "status"))
+	if rss, ok := status["VmRSS"]; ok {
+		s.RSSBytes = parseUint(strings.TrimSuffix(rss, " kB")) * 1024
+	}
+	s.Threads = int(parseUint(status["Threads"]))
+	s.OpenFDs = countFDs(filepath.Join(pa.procDir, "fd"))
+	s.MaxFDs = pa.maxFDs()
+
+	pa.readCgroup(&s)
+	if s.CPULimitCores > 0 {
+		s.CPULimitPercent = 100 * s.CPUUtilization / s.CPULimitCores
+	}
+	usage := s.MemoryUsageBytes
+	if usage == 0 {
+		usage = s.RSSBytes
+	}
+	if s.MemoryLimitBytes > 0 {
+		s.MemoryLimitPercent = 100 * float64(usage) / float64(s.MemoryLimitBytes)
+	}
+
+	pa.lock.Lock()
+	pa.Stats = s
+	pa.lock.Unlock()
+}
+
+// cpuSeconds returns user and system time of /proc/self/stat.
+func (pa *ProcessAspect) cpuSeconds() (float64, bool) {
+	b, err := ioutil.ReadFile(filepath.Join(pa.procDir, "stat"))
+	if err != nil {
+		return 0, false
+	}
+	// the command in parentheses can contain spaces
+	stat := string(b)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	// utime and stime are the 14th and 15th field, fields starts
+	// with the 3rd
+	if len(fields) < 13 {
+		return 0, false
+	}
+	ticks := parseUint(fields[11]) + parseUint(fields[12])
+	return float64(ticks) / clockTicks, true
+}
+
+// maxFDs returns the soft limit of open files of /proc/self/limits.
+func (pa *ProcessAspect) maxFDs() uint64 {
+	f, err := os.Open(filepath.Join(pa.procDir, "limits"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Max open files") {
+			fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+			if len(fields) > 0 {
+				return parseUint(fields[0])
+			}
+		}
+	}
+	return 0
+}
+
+// readCgroup sets the cgroup fields of s. cgroup v2 is detected by
+// cgroup.controllers, otherwise the v1 hierarchies memory and cpu are
+// used. The cgroup of the process is looked up in its cgroup file.
+func (pa *ProcessAspect) readCgroup(s *ProcessStats) {
+	paths := readCgroupPaths(filepath.Join(pa.procDir, "cgroup"))
+	if _, err := os.Stat(filepath.Join(pa.cgroupDir, "cgroup.controllers")); err == nil {
+		dir := cgroupPath(pa.cgroupDir, paths[""])
+		s.CgroupVersion = 2
+		s.MemoryUsageBytes = parseUint(readLine(filepath.Join(dir, "memory.current")))
+		s.MemoryLimitBytes = parseUint(readLine(filepath.Join(dir, "memory.max")))
+		// cpu.max is "$MAX $PERIOD", $MAX is "max" without limit
+		fields := strings.Fields(readLine(filepath.Join(dir, "cpu.max")))
+		if len(fields) == 2 {
+			s.CPULimitCores = cores(parseUint(fields[0]), parseUint(fields[1]))
+		}
+		return
+	}
+
+	memory := cgroupPath(filepath.Join(pa.cgroupDir, "memory"), paths["memory"])
+	usage := readLine(filepath.Join(memory, "memory.usage_in_bytes"))
+	if usage == "" {
+		return
+	}
+	s.CgroupVersion = 1
+	s.MemoryUsageBytes = parseUint(usage)
+	// without limit the maximum page aligned int64 is used
+	if limit := parseUint(readLine(filepath.Join(memory, "memory.limit_in_bytes"))); limit < math.MaxInt64/2 {
+		s.MemoryLimitBytes = limit
+	}
+	cpu := cgroupPath(filepath.Join(pa.cgroupDir, "cpu"), paths["cpu"])
+	quota := readLine(filepath.Join(cpu, "cpu.cfs_quota_us"))
+	period := readLine(filepath.Join(cpu, "cpu.cfs_period_us"))
+	// the quota is -1 without limit, which is parsed as 0
+	s.CPULimitCores = cores(parseUint(quota), parseUint(period))
+}
+
+// readCgroupPaths reads lines like "4:cpu,cpuacct:/app" of file and
+// returns the paths by controller, the cgroup v2 path by "".
+func readCgroupPaths(file string) map[string]string {
+	res := make(map[string]string)
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return res
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			res[controller] = fields[2]
+		}
+	}
+	return res
+}
+
+// cgroupPath returns the cgroup path joined under the hierarchy root,
+// or root if it does not exist, like in containers, that see only
+// their own cgroup.
+func cgroupPath(root, path string) string {
+	dir := filepath.Join(root, path)
+	if _, err := os.Stat(dir); err != nil {
+		return root
+	}
+	return dir
+}
+
+// cores returns quota divided by period, or 0 if there is no limit.
+func cores(quota, period uint64) float64 {
+	if quota == 0 || period == 0 {
+		return 0
+	}
+	return float64(quota) / float64(period)
+}
+
+// readLine returns the first line of file, or "" if it can not be
+// read.
+func readLine(file string) string {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.SplitN(string(b), "\n", 2)[0])
+}
+
+// readKeyValues reads lines like "Key:  value" of file.
+func readKeyValues(file string) map[string]string {
+	res := make(map[string]string)
+	f, err := os.Open(file)
+	if err != nil {
+		return res
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) == 2 {
+			res[kv[0]] = strings.TrimSpace(kv[1])
+		}
+	}
+	return res
+}
+
+// parseUint returns the number s, or 0 if s is not a number like
+// "max" or "-1".
+func parseUint(s string) uint64 {
+	n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
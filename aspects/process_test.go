@@ -0,0 +1,96 @@
+package ginmon
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ProcessAspectCgroupV2(t *testing.T) {
+	pa := NewProcessAspectFrom("testdata/process/proc", "testdata/process/cgroupv2")
+	now := time.Now()
+	pa.prevCPU = 2
+	pa.windowStart = now.Add(-2 * time.Second)
+	pa.calculate(now)
+	s := pa.GetStats().(ProcessStats)
+
+	for _, tc := range []struct {
+		name          string
+		expect, value interface{}
+	}{
+		{"CPUSeconds", 4.0, s.CPUSeconds},
+		{"CPUUtilization", 1.0, s.CPUUtilization},
+		{"CPULimitCores", 2.0, s.CPULimitCores},
+		{"CPULimitPercent", 50.0, s.CPULimitPercent},
+		{"RSSBytes", uint64(8192 * 1024), s.RSSBytes},
+		{"Threads", 12, s.Threads},
+		{"OpenFDs", 4, s.OpenFDs},
+		{"MaxFDs", uint64(1024), s.MaxFDs},
+		{"MemoryUsageBytes", uint64(4194304), s.MemoryUsageBytes},
+		{"MemoryLimitBytes", uint64(16777216), s.MemoryLimitBytes},
+		{"MemoryLimitPercent", 25.0, s.MemoryLimitPercent},
+		{"CgroupVersion", 2, s.CgroupVersion},
+	} {
+		if assert.Equal(t, tc.expect, tc.value, "%s does not work, expect %v but got %v %s",
+			tc.name, tc.expect, tc.value, ballotX) {
+			t.Logf("%s works, expected %v %s", tc.name, tc.value, checkMark)
+		}
+	}
+}
+
+func Test_ProcessAspectCgroupV1(t *testing.T) {
+	pa := NewProcessAspectFrom("testdata/process/proc", "testdata/process/cgroupv1")
+	pa.calculate(time.Now())
+	s := pa.GetStats().(ProcessStats)
+
+	if assert.Equal(t, 1, s.CgroupVersion) && assert.Equal(t, 0.5, s.CPULimitCores,
+		"CPU limit of cgroup v1 does not work, expect %v but got %v %s", 0.5, s.CPULimitCores, ballotX) {
+		t.Logf("CPU limit of cgroup v1 works, expected %v %s", s.CPULimitCores, checkMark)
+	}
+	if assert.Equal(t, uint64(0), s.MemoryLimitBytes, "Unlimited memory should be omitted, but got %d %s",
+		s.MemoryLimitBytes, ballotX) {
+		t.Logf("Unlimited memory is omitted %s", checkMark)
+	}
+}
+
+func Test_ProcessAspectNestedCgroup(t *testing.T) {
+	for _, tc := range []struct {
+		cgroupDir string
+		cores     float64
+	}{
+		{"testdata/process/cgroupv2", 1.0},
+		{"testdata/process/cgroupv1", 1.5},
+	} {
+		pa := NewProcessAspectFrom("testdata/process/nested", tc.cgroupDir)
+		pa.calculate(time.Now())
+		s := pa.GetStats().(ProcessStats)
+		if assert.Equal(t, tc.cores, s.CPULimitCores) && assert.Equal(t, uint64(2097152), s.MemoryLimitBytes,
+			"Nested cgroup of %s does not work, expect %d but got %d %s", tc.cgroupDir, 2097152, s.MemoryLimitBytes, ballotX) {
+			t.Logf("Nested cgroup of %s works, expected %d %s", tc.cgroupDir, s.MemoryLimitBytes, checkMark)
+		}
+	}
+}
+
+func Test_ProcessAspectMissingFiles(t *testing.T) {
+	pa := NewProcessAspectFrom("testdata/process/missing", "testdata/process/missing")
+	pa.calculate(time.Now())
+	s := pa.GetStats().(ProcessStats)
+	if assert.Equal(t, 0.0, s.CPUSeconds) && assert.Equal(t, 0, s.CgroupVersion,
+		"Missing files should be skipped %s", ballotX) {
+		t.Logf("Missing files are skipped %s", checkMark)
+	}
+}
+
+func Test_CountFDs(t *testing.T) {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("no /proc/self/fd")
+	}
+	// ReadDir lists the fd of the directory, too
+	expect := len(fds) - 1
+	if got := countFDs("/proc/self/fd"); assert.Equal(t, expect, got, "countFDs does not work, expect %d but got %d %s", expect, got, ballotX) {
+		t.Logf("countFDs works, expected %d %s", got, checkMark)
+	}
+}
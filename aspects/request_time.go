@@ -2,24 +2,48 @@ package ginmon
 
 import (
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// RequestTimeAspect, exported fields are used to store json
-// fields. All fields are measured in nanoseconds.
+// RequestTimeAspect measures the time of requests, the calculated data
+// are served as RequestTimeStats.
 type RequestTimeAspect struct {
+	lock                   sync.RWMutex
 	lastMinuteRequestTimes []float64
-	Count                  int       `json:"count"`
-	Min                    float64   `json:"min"`
-	Max                    float64   `json:"max"`
-	Mean                   float64   `json:"mean"`
-	Stdev                  float64   `json:"stdev"`
-	P90                    float64   `json:"p90"`
-	P95                    float64   `json:"p95"`
-	P99                    float64   `json:"p99"`
-	Timestamp              time.Time `json:"timestamp"`
+	traced                 []Exemplar
+	windowStart            time.Time
+	histogram              float64
+	sampler                Sampler
+	traceHeader            string
+	RequestTimeStats
+}
+
+// RequestTimeStats, exported fields are used to store json
+// fields. Durations are measured in nanoseconds, RatePerSecond is the
+// Count divided by WindowSeconds, the length of the time frame. Count
+// and Sum are scaled up by SampleRate, if a Sampler is set.
+type RequestTimeStats struct {
+	SampleRate    float64   `json:"sample_rate"`
+	Count         int       `json:"count"`
+	Sum           float64   `json:"sum"`
+	RatePerSecond float64   `json:"rate_per_second"`
+	WindowSeconds float64   `json:"window_seconds"`
+	Min           float64   `json:"min"`
+	Max           float64   `json:"max"`
+	Mean          float64   `json:"mean"`
+	Stdev         float64   `json:"stdev"`
+	P90           float64   `json:"p90"`
+	P95           float64   `json:"p95"`
+	P99           float64   `json:"p99"`
+	Timestamp     time.Time `json:"timestamp"`
+	// Histogram is set if enabled by EnableHistogram.
+	Histogram *Histogram `json:"histogram,omitempty"`
+	// Exemplars are set if enabled by EnableExemplars, by ExemplarMax,
+	// ExemplarP90, ExemplarP95 and ExemplarP99.
+	Exemplars map[string]Exemplar `json:"exemplars,omitempty"`
 }
 
 // NewRequestTimeAspect returns a new initialized RequestTimeAspect
@@ -28,6 +52,8 @@ func NewRequestTimeAspect() *RequestTimeAspect {
 	rt := &RequestTimeAspect{}
 	rt.lastMinuteRequestTimes = make([]float64, 0)
 	rt.Timestamp = time.Now()
+	rt.windowStart = rt.Timestamp
+	rt.SampleRate = 1
 	return rt
 }
 
@@ -43,10 +69,37 @@ func (rt *RequestTimeAspect) StartTimer(d time.Duration) {
 	}()
 }
 
-// GetStats to fulfill aspects.Aspect interface, it returns the data
-// that will be served as JSON.
+// EnableHistogram exposes a Histogram with the given relative error,
+// such that the data of many instances can be combined with Merge. It
+// has to be called before StartTimer.
+func (rt *RequestTimeAspect) EnableHistogram(relativeError float64) {
+	rt.histogram = relativeError
+}
+
+// SetSampler records only the requests sampled by s. It has to be
+// called before StartTimer.
+func (rt *RequestTimeAspect) SetSampler(s Sampler) {
+	rt.sampler = s
+}
+
+// EnableExemplars keeps the trace IDs of requests, found in header, as
+// exemplars of the max and the quantiles. A W3C traceparent header is
+// parsed, values of other headers are used if they have at most 64
+// letters, digits or any of "-_.:". An empty header uses
+// DefaultTraceIDHeader. It has to be called before StartTimer.
+func (rt *RequestTimeAspect) EnableExemplars(header string) {
+	if header == "" {
+		header = DefaultTraceIDHeader
+	}
+	rt.traceHeader = header
+}
+
+// GetStats to fulfill aspects.Aspect interface, it returns the
+// RequestTimeStats that will be served as JSON.
 func (rt *RequestTimeAspect) GetStats() interface{} {
-	return rt
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+	return rt.RequestTimeStats
 }
 
 // Name to fulfill aspects.Aspect interface, it will return the name
@@ -61,37 +114,84 @@ func (rt *RequestTimeAspect) InRoot() bool {
 	return false
 }
 
-// RequestTimeHandler is a middleware function to use in Gin
-func RequestTimeHandler(rt *RequestTimeAspect) gin.HandlerFunc {
+// RequestTimeHandler is a middleware function to use in Gin, it
+// records requests, that pass all filters.
+func RequestTimeHandler(rt *RequestTimeAspect, filters ...Filter) gin.HandlerFunc {
 	_rt := rt // save rt in closure
 	return func(c *gin.Context) {
 		now := time.Now()
 		c.Next()
 		took := time.Now().Sub(now)
+		if !record(c, filters) || !_rt.sample() {
+			return
+		}
 		_rt.add(float64(took))
+		if _rt.traceHeader == "" {
+			return
+		}
+		if id := traceID(c.Request, _rt.traceHeader); id != "" {
+			_rt.addTraced(Exemplar{TraceID: id, Value: float64(took), Timestamp: time.Now()})
+		}
 	}
 }
 
+func (rt *RequestTimeAspect) addTraced(e Exemplar) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	rt.traced = append(rt.traced, e)
+}
+
+func (rt *RequestTimeAspect) sample() bool {
+	return rt.sampler == nil || rt.sampler.Sample()
+}
+
 func (rt *RequestTimeAspect) add(n float64) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
 	rt.lastMinuteRequestTimes = append(rt.lastMinuteRequestTimes, n)
 }
 
 func (rt *RequestTimeAspect) calculate() {
+	rt.lock.Lock()
 	sortedSlice := rt.lastMinuteRequestTimes[:]
 	rt.lastMinuteRequestTimes = make([]float64, 0)
+	traced := rt.traced
+	rt.traced = nil
+	now := time.Now()
+	window := now.Sub(rt.windowStart)
+	rt.windowStart = now
+	rt.lock.Unlock()
+	rate := 1.0
+	if rt.sampler != nil {
+		rate = rt.sampler.Window()
+	}
 	l := len(sortedSlice)
 	if l <= 1 {
 		return
 	}
 	sort.Float64s(sortedSlice)
 
-	rt.Timestamp = time.Now()
-	rt.Count = l
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	rt.Timestamp = now
+	rt.Count = scaleCount(l, rate)
+	s := sum(sortedSlice, l)
+	rt.Sum = scale(s, rate)
+	rt.RatePerSecond = perSecond(float64(rt.Count), window)
+	rt.WindowSeconds = window.Seconds()
+	rt.SampleRate = rate
 	rt.Min = sortedSlice[0]
 	rt.Max = sortedSlice[l-1]
-	rt.Mean = mean(sortedSlice, l)
+	rt.Mean = s / float64(l)
 	rt.Stdev = correctedStdev(sortedSlice, rt.Mean, l)
 	rt.P90 = p90(sortedSlice, l)
 	rt.P95 = p95(sortedSlice, l)
 	rt.P99 = p99(sortedSlice, l)
+	if rt.histogram > 0 {
+		rt.Histogram = newHistogramFrom(rt.histogram, sortedSlice)
+		rt.Histogram.scale(rate)
+	}
+	if rt.traceHeader != "" {
+		rt.Exemplars = exemplarsFor(traced, rt.P90, rt.P95, rt.P99)
+	}
 }
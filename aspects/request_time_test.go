@@ -2,6 +2,7 @@ package ginmon
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -39,7 +40,7 @@ func TestRequestTimer_GetStats(t *testing.T) {
 	}
 
 	epsilon := 0.01
-	stat := rt.GetStats().(*RequestTimeAspect)
+	stat := rt.GetStats().(RequestTimeStats)
 
 	if assert.InEpsilon(t, 99, stat.Max, epsilon, "Return of getstats should have a Max") {
 		t.Logf("Should be 99 %s", checkMark)
@@ -73,7 +74,7 @@ func (rt *RequestTimeAspect) createValues(n int) {
 func (rt *RequestTimeAspect) runBenchRequestTimerCalculate(i int) {
 	rt.createValues(i)
 	rt.calculate()
-	stat := rt.GetStats().(*RequestTimeAspect)
+	stat := rt.GetStats().(RequestTimeStats)
 	_ = stat.P95
 }
 
@@ -217,3 +218,36 @@ func TestRequestTimer_InRoot(t *testing.T) {
 			expect, rt.InRoot(), checkMark)
 	}
 }
+
+func TestRequestTimer_SumAndRate(t *testing.T) {
+	rt := NewRequestTimeAspect()
+	rt.windowStart = rt.windowStart.Add(-2 * time.Second)
+	for i := 1; i <= 10; i++ {
+		rt.add(float64(i))
+	}
+	rt.calculate()
+
+	if assert.Equal(t, 55.0, rt.Sum, "Sum does not work, expect %v but got %v %s",
+		55.0, rt.Sum, ballotX) {
+		t.Logf("Sum works, expected %v %s", rt.Sum, checkMark)
+	}
+	if assert.InEpsilon(t, 2.0, rt.WindowSeconds, 0.01, "WindowSeconds does not work, expect %v but got %v %s",
+		2.0, rt.WindowSeconds, ballotX) {
+		t.Logf("WindowSeconds works, expected %v %s", rt.WindowSeconds, checkMark)
+	}
+	if assert.InEpsilon(t, 5.0, rt.RatePerSecond, 0.01, "RatePerSecond does not work, expect %v but got %v %s",
+		5.0, rt.RatePerSecond, ballotX) {
+		t.Logf("RatePerSecond works, expected %v %s", rt.RatePerSecond, checkMark)
+	}
+}
+
+func TestRequestTimer_ZeroValue(t *testing.T) {
+	rt := &RequestTimeAspect{}
+	rt.add(1.0)
+	rt.add(2.0)
+	rt.calculate()
+	stats := rt.GetStats().(RequestTimeStats)
+	if assert.Equal(t, 2, stats.Count, "Zero value does not work, expect %d but got %d %s", 2, stats.Count, ballotX) {
+		t.Logf("Zero value works, expected %d %s", stats.Count, checkMark)
+	}
+}
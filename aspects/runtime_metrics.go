@@ -0,0 +1,249 @@
+package ginmon
+
+import (
+	"math"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+// DefaultRuntimeMetrics are the metrics of runtime/metrics exposed by
+// a RuntimeMetricsAspect, if no names are given.
+var DefaultRuntimeMetrics = []string{
+	"/sched/pauses/total/gc:seconds",
+	"/sched/latencies:seconds",
+	"/sched/goroutines:goroutines",
+	"/memory/classes/heap/objects:bytes",
+	"/memory/classes/heap/free:bytes",
+	"/memory/classes/heap/released:bytes",
+	"/memory/classes/heap/stacks:bytes",
+	"/memory/classes/heap/unused:bytes",
+	"/memory/classes/total:bytes",
+	"/sync/mutex/wait/total:seconds",
+	"/gc/cycles/total:gc-cycles",
+	"/gc/heap/allocs:bytes",
+}
+
+// runtimeMetricFallbacks are used if a metric is not supported by the
+// Go version, like the GC pauses added in Go 1.22.
+var runtimeMetricFallbacks = map[string]string{
+	"/sched/pauses/total/gc:seconds": "/gc/pauses:seconds",
+}
+
+// RuntimeMetric is the calculated data of one metric of
+// runtime/metrics. Value is the current value of a gauge or the total
+// of a counter, Delta is the increase of a counter in the time
+// frame. Histograms like GC pauses and scheduler latencies are
+// summarized by the Count and quantiles of the time frame, which are
+// upper bounds of the buckets of the runtime.
+type RuntimeMetric struct {
+	Kind          string  `json:"kind"`
+	Value         float64 `json:"value"`
+	Delta         float64 `json:"delta"`
+	RatePerSecond float64 `json:"rate_per_second"`
+	Count         uint64  `json:"count"`
+	P50           float64 `json:"p50"`
+	P90           float64 `json:"p90"`
+	P99           float64 `json:"p99"`
+	Max           float64 `json:"max"`
+}
+
+// RuntimeMetricsAspect exposes metrics of runtime/metrics, which can
+// be read without stopping the world. Unknown metrics are replaced by
+// the metric they replaced in older Go versions, like
+// /gc/pauses:seconds, or skipped, such that the same names can be
+// used with different Go versions.
+type RuntimeMetricsAspect struct {
+	lock        sync.RWMutex
+	samples     []metrics.Sample
+	cumulative  map[string]bool
+	prev        map[string]previous
+	windowStart time.Time
+	Metrics     map[string]RuntimeMetric
+}
+
+// NewRuntimeMetricsAspect returns a new initialized
+// RuntimeMetricsAspect for the given metric names, or for
+// DefaultRuntimeMetrics if no names are given.
+func NewRuntimeMetricsAspect(names ...string) *RuntimeMetricsAspect {
+	if len(names) == 0 {
+		names = DefaultRuntimeMetrics
+	}
+	known := make(map[string]bool)
+	ra := &RuntimeMetricsAspect{
+		cumulative: make(map[string]bool),
+		prev:       make(map[string]previous),
+		Metrics:    make(map[string]RuntimeMetric),
+	}
+	for _, d := range metrics.All() {
+		known[d.Name] = true
+		ra.cumulative[d.Name] = d.Cumulative
+	}
+	for _, name := range supportedNames(names, known) {
+		ra.samples = append(ra.samples, metrics.Sample{Name: name})
+	}
+	ra.read()
+	ra.windowStart = time.Now()
+	return ra
+}
+
+// supportedNames returns the known names, unknown names are replaced
+// by their known fallback or skipped.
+func supportedNames(names []string, known map[string]bool) []string {
+	var res []string
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !known[name] {
+			name = runtimeMetricFallbacks[name]
+		}
+		if known[name] && !seen[name] {
+			seen[name] = true
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// StartTimer will call a forever loop in a goroutine to calculate
+// metrics for measurements every d ticks.
+func (ra *RuntimeMetricsAspect) StartTimer(d time.Duration) {
+	timer := time.Tick(d)
+	go func() {
+		for {
+			<-timer
+			ra.calculate()
+		}
+	}()
+}
+
+// GetStats to fulfill aspects.Aspect interface, it returns the data
+// that will be served as JSON.
+func (ra *RuntimeMetricsAspect) GetStats() interface{} {
+	ra.lock.RLock()
+	defer ra.lock.RUnlock()
+	res := make(map[string]RuntimeMetric, len(ra.Metrics))
+	for name, m := range ra.Metrics {
+		res[name] = m
+	}
+	return res
+}
+
+// Name to fulfill aspects.Aspect interface, it will return the name
+// of the JSON object that will be served.
+func (ra *RuntimeMetricsAspect) Name() string {
+	return "RuntimeMetrics"
+}
+
+// InRoot to fulfill aspects.Aspect interface, it will return where to
+// put the JSON object into the monitoring endpoint.
+func (ra *RuntimeMetricsAspect) InRoot() bool {
+	return false
+}
+
+// previous is a copy of a value of the last read, histograms are
+// reused by metrics.Read.
+type previous struct {
+	value  float64
+	counts []uint64
+}
+
+// read reads the current values and returns the previous ones.
+func (ra *RuntimeMetricsAspect) read() map[string]previous {
+	metrics.Read(ra.samples)
+	prev := ra.prev
+	ra.prev = make(map[string]previous, len(ra.samples))
+	for _, s := range ra.samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			ra.prev[s.Name] = previous{value: float64(s.Value.Uint64())}
+		case metrics.KindFloat64:
+			ra.prev[s.Name] = previous{value: s.Value.Float64()}
+		case metrics.KindFloat64Histogram:
+			counts := s.Value.Float64Histogram().Counts
+			ra.prev[s.Name] = previous{counts: append([]uint64(nil), counts...)}
+		}
+	}
+	return prev
+}
+
+func (ra *RuntimeMetricsAspect) calculate() {
+	now := time.Now()
+	window := now.Sub(ra.windowStart)
+	ra.windowStart = now
+	prev := ra.read()
+
+	res := make(map[string]RuntimeMetric, len(ra.samples))
+	for _, s := range ra.samples {
+		var m RuntimeMetric
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			m.Value = float64(s.Value.Uint64())
+		case metrics.KindFloat64:
+			m.Value = s.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			m = histogramMetric(s.Value.Float64Histogram(), prev[s.Name].counts)
+			m.RatePerSecond = perSecond(float64(m.Count), window)
+			res[s.Name] = m
+			continue
+		default:
+			continue
+		}
+
+		m.Kind = KindGauge.String()
+		if ra.cumulative[s.Name] {
+			m.Kind = KindCounter.String()
+			m.Delta = m.Value - prev[s.Name].value
+			m.RatePerSecond = perSecond(m.Delta, window)
+		}
+		res[s.Name] = m
+	}
+
+	ra.lock.Lock()
+	ra.Metrics = res
+	ra.lock.Unlock()
+}
+
+// histogramMetric summarizes the values of cur, that were added since
+// the counts old were read.
+func histogramMetric(cur *metrics.Float64Histogram, old []uint64) RuntimeMetric {
+	counts := make([]uint64, len(cur.Counts))
+	var total uint64
+	for i, n := range cur.Counts {
+		if len(old) == len(cur.Counts) {
+			n -= old[i]
+		}
+		counts[i] = n
+		total += n
+	}
+
+	m := RuntimeMetric{Kind: KindDistribution.String(), Count: total}
+	if total == 0 {
+		return m
+	}
+	m.P50 = bucketQuantile(cur.Buckets, counts, total, 0.5)
+	m.P90 = bucketQuantile(cur.Buckets, counts, total, 0.9)
+	m.P99 = bucketQuantile(cur.Buckets, counts, total, 0.99)
+	m.Max = bucketQuantile(cur.Buckets, counts, total, 1)
+	return m
+}
+
+// bucketQuantile returns the upper bound of the bucket containing the
+// quantile q. Bucket i contains values in [buckets[i], buckets[i+1]),
+// an infinite upper bound is replaced by the lower bound.
+func bucketQuantile(buckets []float64, counts []uint64, total uint64, q float64) float64 {
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range counts {
+		seen += n
+		if seen >= rank {
+			if math.IsInf(buckets[i+1], 1) {
+				return buckets[i]
+			}
+			return buckets[i+1]
+		}
+	}
+	return buckets[len(buckets)-1]
+}
@@ -0,0 +1,66 @@
+package ginmon
+
+import (
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RuntimeMetricsAspect(t *testing.T) {
+	ra := NewRuntimeMetricsAspect()
+	runtime.GC()
+	ra.calculate()
+	stats := ra.GetStats().(map[string]RuntimeMetric)
+
+	goroutines := stats["/sched/goroutines:goroutines"]
+	if assert.Equal(t, KindGauge.String(), goroutines.Kind) && assert.True(t, goroutines.Value > 0,
+		"Gauge does not work, expect goroutines but got %v %s", goroutines.Value, ballotX) {
+		t.Logf("Gauge works, got %v goroutines %s", goroutines.Value, checkMark)
+	}
+
+	cycles := stats["/gc/cycles/total:gc-cycles"]
+	if assert.Equal(t, KindCounter.String(), cycles.Kind) && assert.True(t, cycles.Delta >= 1,
+		"Counter delta does not work, expect at least 1 but got %v %s", cycles.Delta, ballotX) {
+		t.Logf("Counter delta works, got %v %s", cycles.Delta, checkMark)
+	}
+
+	pauses := stats["/sched/pauses/total/gc:seconds"]
+	if assert.Equal(t, KindDistribution.String(), pauses.Kind) && assert.True(t, pauses.Count >= 1,
+		"Histogram does not work, expect GC pauses but got %d %s", pauses.Count, ballotX) {
+		t.Logf("Histogram works, got %d GC pauses %s", pauses.Count, checkMark)
+	}
+
+	ra = NewRuntimeMetricsAspect("/sched/goroutines:goroutines", "/not/a/metric:bytes")
+	ra.calculate()
+	stats = ra.GetStats().(map[string]RuntimeMetric)
+	if assert.Len(t, stats, 1, "Selection does not work, expect %d metrics but got %d %s",
+		1, len(stats), ballotX) {
+		t.Logf("Selection works, expected %d metrics %s", len(stats), checkMark)
+	}
+}
+
+func Test_SupportedNames(t *testing.T) {
+	old := map[string]bool{"/gc/pauses:seconds": true, "/sched/goroutines:goroutines": true}
+	got := supportedNames([]string{"/sched/pauses/total/gc:seconds", "/gc/pauses:seconds", "/sched/goroutines:goroutines", "/not/a/metric:bytes"}, old)
+	expect := []string{"/gc/pauses:seconds", "/sched/goroutines:goroutines"}
+	if assert.Equal(t, expect, got, "Fallback does not work, expect %v but got %v %s", expect, got, ballotX) {
+		t.Logf("Fallback works, expected %v %s", got, checkMark)
+	}
+}
+
+func Test_BucketQuantile(t *testing.T) {
+	buckets := []float64{math.Inf(-1), 1, 2, 4, math.Inf(1)}
+	counts := []uint64{0, 90, 9, 1}
+	for _, tc := range []struct {
+		q      float64
+		expect float64
+	}{{0.5, 2}, {0.9, 2}, {0.99, 4}, {1, 4}} {
+		got := bucketQuantile(buckets, counts, 100, tc.q)
+		if assert.Equal(t, tc.expect, got, "Quantile %v does not work, expect %v but got %v %s",
+			tc.q, tc.expect, got, ballotX) {
+			t.Logf("Quantile %v works, expected %v %s", tc.q, got, checkMark)
+		}
+	}
+}
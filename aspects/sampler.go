@@ -0,0 +1,104 @@
+package ginmon
+
+import (
+	"math"
+	"math/rand"
+	"sync/atomic"
+)
+
+// Sampler decides which observations are recorded by an aspect, to
+// reduce the costs at high traffic. Aspects scale count, sum and rate
+// of the recorded observations back up by the sample rate and expose
+// the rate as sample_rate. Implementations have to be safe for
+// concurrent use.
+type Sampler interface {
+	// Sample returns true if the observation should be recorded.
+	Sample() bool
+	// Window is called at the end of each time frame, it returns the
+	// probability that an observation of the time frame was recorded.
+	Window() float64
+}
+
+// fixedRate records observations with a fixed probability.
+type fixedRate float64
+
+// FixedRate returns a Sampler, that records observations with the
+// given probability in (0,1].
+//
+// Example:
+//    	requestAspect.SetSampler(ginmon.FixedRate(0.01))
+func FixedRate(rate float64) Sampler {
+	return fixedRate(math.Min(math.Max(rate, 0), 1))
+}
+
+func (fr fixedRate) Sample() bool {
+	return fr >= 1 || rand.Float64() < float64(fr)
+}
+
+func (fr fixedRate) Window() float64 {
+	return float64(fr)
+}
+
+// adaptiveRate adjusts the probability every time frame, such that
+// about target observations are recorded.
+type adaptiveRate struct {
+	seen   uint64 // accessed atomically, first for 64-bit alignment
+	rate   uint64 // float64 bits, accessed atomically
+	target float64
+}
+
+// AdaptiveRate returns a Sampler, that records about target
+// observations per time frame. The rate of a time frame is based on
+// the number of observations of the previous one, it starts with
+// recording all observations.
+func AdaptiveRate(target int) Sampler {
+	return &adaptiveRate{rate: math.Float64bits(1), target: float64(target)}
+}
+
+func (ar *adaptiveRate) Sample() bool {
+	atomic.AddUint64(&ar.seen, 1)
+	rate := math.Float64frombits(atomic.LoadUint64(&ar.rate))
+	return rate >= 1 || rand.Float64() < rate
+}
+
+func (ar *adaptiveRate) Window() float64 {
+	seen := float64(atomic.SwapUint64(&ar.seen, 0))
+	next := 1.0
+	if seen > ar.target {
+		next = ar.target / seen
+	}
+	return math.Float64frombits(atomic.SwapUint64(&ar.rate, math.Float64bits(next)))
+}
+
+// scale returns n scaled up by the sample rate.
+func scale(n, rate float64) float64 {
+	if rate <= 0 || rate >= 1 {
+		return n
+	}
+	return n / rate
+}
+
+// scaleCount returns the count n scaled up by the sample rate.
+func scaleCount(n int, rate float64) int {
+	return int(math.Round(scale(float64(n), rate)))
+}
+
+// scale scales the counts of h up by the sample rate, such that
+// histograms of instances with different rates can be merged.
+func (h *Histogram) scale(rate float64) {
+	if rate <= 0 || rate >= 1 {
+		return
+	}
+	h.Sum = scale(h.Sum, rate)
+	h.SumOfSquares = scale(h.SumOfSquares, rate)
+	h.Zero = scaleCount(h.Zero, rate)
+	h.Count = h.Zero
+	for i, n := range h.Positive {
+		h.Positive[i] = scaleCount(n, rate)
+		h.Count += h.Positive[i]
+	}
+	for i, n := range h.Negative {
+		h.Negative[i] = scaleCount(n, rate)
+		h.Count += h.Negative[i]
+	}
+}
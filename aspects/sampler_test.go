@@ -0,0 +1,135 @@
+package ginmon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// everyNth is a deterministic Sampler for tests.
+type everyNth struct {
+	n, i int
+}
+
+func (e *everyNth) Sample() bool {
+	e.i++
+	return e.i%e.n == 0
+}
+
+func (e *everyNth) Window() float64 {
+	return 1 / float64(e.n)
+}
+
+func Test_FixedRate(t *testing.T) {
+	all := FixedRate(2)
+	for i := 0; i < 100; i++ {
+		assert.True(t, all.Sample(), "Rate 1 should sample all %s", ballotX)
+	}
+	if assert.Equal(t, 1.0, all.Window(), "FixedRate should be limited to 1 %s", ballotX) {
+		t.Logf("FixedRate is limited to 1 %s", checkMark)
+	}
+
+	none := FixedRate(0)
+	for i := 0; i < 100; i++ {
+		assert.False(t, none.Sample(), "Rate 0 should sample nothing %s", ballotX)
+	}
+}
+
+func Test_AdaptiveRate(t *testing.T) {
+	ar := AdaptiveRate(100)
+	for i := 0; i < 1000; i++ {
+		assert.True(t, ar.Sample(), "First window should sample all %s", ballotX)
+	}
+	if assert.Equal(t, 1.0, ar.Window(), "Rate of first window does not work %s", ballotX) {
+		t.Logf("Rate of first window works %s", checkMark)
+	}
+
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		if ar.Sample() {
+			sampled++
+		}
+	}
+	rate := ar.Window()
+	if assert.Equal(t, 0.1, rate, "Adaptive rate does not work, expect %v but got %v %s", 0.1, rate, ballotX) {
+		t.Logf("Adaptive rate works, expected %v %s", rate, checkMark)
+	}
+	if assert.InDelta(t, 100, sampled, 50, "Adaptive sampling does not work, expect about %d but got %d %s",
+		100, sampled, ballotX) {
+		t.Logf("Adaptive sampling works, sampled %d %s", sampled, checkMark)
+	}
+
+	if assert.Equal(t, 1.0, AdaptiveRate(100).Window(), "Empty window should reset the rate %s", ballotX) {
+		t.Logf("Empty window resets the rate %s", checkMark)
+	}
+}
+
+func Test_SampledGenericChannel(t *testing.T) {
+	gc := NewGenericChannelAspect("generic")
+	gc.SetSampler(&everyNth{n: 4})
+	gc.EnableHistograms(DefaultRelativeError)
+	for i := 1; i <= 100; i++ {
+		gc.Observe("latency", float64(i))
+	}
+	for i := 1; i <= 100; i++ {
+		gc.Inc("jobs")
+	}
+	for i := 1; i <= 100; i++ {
+		gc.Set("queue", float64(i))
+	}
+	gc.calculate()
+
+	latency := gc.Gcd["latency"]
+	if assert.Equal(t, 100, latency.Count, "Scaled count does not work, expect %d but got %d %s",
+		100, latency.Count, ballotX) {
+		t.Logf("Scaled count works, expected %d %s", latency.Count, checkMark)
+	}
+	if assert.Equal(t, 0.25, latency.SampleRate, "SampleRate does not work, expect %v but got %v %s",
+		0.25, latency.SampleRate, ballotX) {
+		t.Logf("SampleRate works, expected %v %s", latency.SampleRate, checkMark)
+	}
+	if assert.Equal(t, 100, latency.Histogram.Count, "Scaled histogram does not work, expect %d but got %d %s",
+		100, latency.Histogram.Count, ballotX) {
+		t.Logf("Scaled histogram works, expected %d %s", latency.Histogram.Count, checkMark)
+	}
+
+	jobs := gc.Gcd["jobs"]
+	if assert.Equal(t, 100.0, jobs.Value, "Scaled counter does not work, expect %v but got %v %s",
+		100.0, jobs.Value, ballotX) {
+		t.Logf("Scaled counter works, expected %v %s", jobs.Value, checkMark)
+	}
+
+	queue := gc.Gcd["queue"]
+	if assert.Equal(t, 100.0, queue.Value, "Gauges should not be sampled, expect %v but got %v %s",
+		100.0, queue.Value, ballotX) && assert.Equal(t, 1.0, queue.SampleRate) {
+		t.Logf("Gauges are not sampled %s", checkMark)
+	}
+}
+
+func Test_SampledRequestTime(t *testing.T) {
+	rt := NewRequestTimeAspect()
+	rt.SetSampler(&everyNth{n: 2})
+	for i := 1; i <= 100; i++ {
+		if rt.sample() {
+			rt.add(float64(i))
+		}
+	}
+	rt.calculate()
+
+	if assert.Equal(t, 100, rt.Count, "Scaled count does not work, expect %d but got %d %s",
+		100, rt.Count, ballotX) {
+		t.Logf("Scaled count works, expected %d %s", rt.Count, checkMark)
+	}
+	if assert.Equal(t, 5100.0, rt.Sum, "Scaled sum does not work, expect %v but got %v %s",
+		5100.0, rt.Sum, ballotX) {
+		t.Logf("Scaled sum works, expected %v %s", rt.Sum, checkMark)
+	}
+	if assert.Equal(t, 51.0, rt.Mean, "Mean does not work, expect %v but got %v %s",
+		51.0, rt.Mean, ballotX) {
+		t.Logf("Mean works, expected %v %s", rt.Mean, checkMark)
+	}
+	if assert.Equal(t, 0.5, rt.SampleRate, "SampleRate does not work, expect %v but got %v %s",
+		0.5, rt.SampleRate, ballotX) {
+		t.Logf("SampleRate works, expected %v %s", rt.SampleRate, checkMark)
+	}
+}
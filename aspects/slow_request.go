@@ -0,0 +1,286 @@
+package ginmon
+
+import (
+	"container/heap"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRequestIDHeader is the default header of the request ID of a
+// SlowRequest.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// redacted replaces the values of redacted query parameters.
+const redacted = "REDACTED"
+
+// DefaultRedactedParams are the query parameters, whose values are
+// redacted by a new SlowRequestAspect.
+var DefaultRedactedParams = []string{
+	"access_token", "api_key", "apikey", "code", "key", "password",
+	"secret", "signature", "sig", "token",
+}
+
+// SlowRequest is a request recorded by SlowRequestAspect.
+type SlowRequest struct {
+	Method          string    `json:"method"`
+	Route           string    `json:"route"`
+	Path            string    `json:"path"`
+	Query           string    `json:"query,omitempty"`
+	Status          int       `json:"status"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	RequestID       string    `json:"request_id,omitempty"`
+	TraceID         string    `json:"trace_id,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// SlowRequestStats are the slowest requests of a time frame, the
+// slowest first.
+type SlowRequestStats struct {
+	Requests      []SlowRequest `json:"requests"`
+	WindowSeconds float64       `json:"window_seconds"`
+	Timestamp     time.Time     `json:"timestamp"`
+}
+
+// SlowRequestAspect keeps the N slowest requests of each time frame,
+// such that the requests behind high percentiles can be found.
+// Requests slower than the threshold set by SetThreshold are logged.
+//
+// Example:
+//    	slowAspect := ginmon.NewSlowRequestAspect(10)
+//    	slowAspect.SetThreshold(2 * time.Second)
+//    	slowAspect.StartTimer(time.Minute)
+//    	router.Use(ginmon.SlowRequestHandler(slowAspect))
+type SlowRequestAspect struct {
+	lock            sync.RWMutex
+	n               int
+	threshold       time.Duration
+	logger          *slog.Logger
+	redact          map[string]bool
+	redactAll       bool
+	requestIDHeader string
+	traceIDHeader   string
+	slowest         slowHeap // guarded by lock
+	windowStart     time.Time
+	Stats           SlowRequestStats
+}
+
+// NewSlowRequestAspect returns a new initialized SlowRequestAspect,
+// that keeps the n slowest requests.
+func NewSlowRequestAspect(n int) *SlowRequestAspect {
+	sa := &SlowRequestAspect{
+		n:               n,
+		logger:          slog.Default(),
+		requestIDHeader: DefaultRequestIDHeader,
+		traceIDHeader:   DefaultTraceIDHeader,
+		windowStart:     time.Now(),
+		Stats:           SlowRequestStats{Requests: []SlowRequest{}},
+	}
+	sa.SetRedactedParams(DefaultRedactedParams...)
+	return sa
+}
+
+// SetThreshold logs each request slower than d to the logger set by
+// SetLogger. The default 0 does not log requests. It has to be called
+// before SlowRequestHandler is used.
+func (sa *SlowRequestAspect) SetThreshold(d time.Duration) {
+	sa.threshold = d
+}
+
+// SetLogger sets the logger of slow requests, slog.Default() is used
+// by default. It has to be called before SlowRequestHandler is used.
+func (sa *SlowRequestAspect) SetLogger(l *slog.Logger) {
+	sa.logger = l
+}
+
+// SetRedactedParams replaces the values of the given query parameters
+// by REDACTED, names are case insensitive. The name "*" redacts all
+// values, no names keep the query as it is. It has to be called before
+// SlowRequestHandler is used.
+func (sa *SlowRequestAspect) SetRedactedParams(names ...string) {
+	sa.redact = make(map[string]bool, len(names))
+	sa.redactAll = false
+	for _, name := range names {
+		if name == "*" {
+			sa.redactAll = true
+		}
+		sa.redact[strings.ToLower(name)] = true
+	}
+}
+
+// SetHeaders sets the request headers of the request ID and trace ID.
+// A W3C traceparent header is parsed, other headers are used as they
+// are. It has to be called before SlowRequestHandler is used.
+func (sa *SlowRequestAspect) SetHeaders(requestID, traceID string) {
+	sa.requestIDHeader = requestID
+	sa.traceIDHeader = traceID
+}
+
+// StartTimer will call a forever loop in a goroutine to calculate
+// metrics for measurements every d ticks.
+func (sa *SlowRequestAspect) StartTimer(d time.Duration) {
+	timer := time.Tick(d)
+	go func() {
+		for {
+			<-timer
+			sa.calculate()
+		}
+	}()
+}
+
+// GetStats to fulfill aspects.Aspect interface, it returns the data
+// that will be served as JSON.
+func (sa *SlowRequestAspect) GetStats() interface{} {
+	sa.lock.RLock()
+	defer sa.lock.RUnlock()
+	return sa.Stats
+}
+
+// Name to fulfill aspects.Aspect interface, it will return the name
+// of the JSON object that will be served.
+func (sa *SlowRequestAspect) Name() string {
+	return "SlowRequests"
+}
+
+// InRoot to fulfill aspects.Aspect interface, it will return where to
+// put the JSON object into the monitoring endpoint.
+func (sa *SlowRequestAspect) InRoot() bool {
+	return false
+}
+
+// SlowRequestHandler is a middleware function to use in Gin, it
+// records requests, that pass all filters.
+func SlowRequestHandler(sa *SlowRequestAspect, filters ...Filter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		took := time.Since(start)
+		if !record(c, filters) {
+			return
+		}
+		logged := sa.threshold > 0 && took >= sa.threshold
+		if !logged && !sa.slower(took) {
+			return
+		}
+
+		req := SlowRequest{
+			Method:          c.Request.Method,
+			Route:           route(c),
+			Path:            c.Request.URL.Path,
+			Query:           sa.redactQuery(c.Request.URL.RawQuery),
+			Status:          c.Writer.Status(),
+			DurationSeconds: took.Seconds(),
+			RequestID:       c.Request.Header.Get(sa.requestIDHeader),
+			TraceID:         traceID(c.Request, sa.traceIDHeader),
+			Timestamp:       start,
+		}
+		if logged {
+			sa.log(c.Request, req)
+		}
+		sa.add(req)
+	}
+}
+
+// slower returns true if a request taking d is one of the n slowest
+// requests so far.
+func (sa *SlowRequestAspect) slower(d time.Duration) bool {
+	sa.lock.RLock()
+	defer sa.lock.RUnlock()
+	return sa.n > 0 && (len(sa.slowest) < sa.n || d.Seconds() > sa.slowest[0].DurationSeconds)
+}
+
+func (sa *SlowRequestAspect) add(req SlowRequest) {
+	if sa.n <= 0 {
+		return
+	}
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	if len(sa.slowest) < sa.n {
+		heap.Push(&sa.slowest, req)
+	} else if req.DurationSeconds > sa.slowest[0].DurationSeconds {
+		sa.slowest[0] = req
+		heap.Fix(&sa.slowest, 0)
+	}
+}
+
+func (sa *SlowRequestAspect) log(r *http.Request, req SlowRequest) {
+	sa.logger.LogAttrs(r.Context(), slog.LevelWarn, "slow request",
+		slog.String("method", req.Method),
+		slog.String("route", req.Route),
+		slog.String("path", req.Path),
+		slog.String("query", req.Query),
+		slog.Int("status", req.Status),
+		slog.Float64("duration_seconds", req.DurationSeconds),
+		slog.String("request_id", req.RequestID),
+		slog.String("trace_id", req.TraceID),
+	)
+}
+
+// redactQuery replaces the values of redacted parameters of the raw
+// query.
+func (sa *SlowRequestAspect) redactQuery(raw string) string {
+	if raw == "" || len(sa.redact) == 0 {
+		return raw
+	}
+	params := strings.Split(raw, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		key := name
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			key = unescaped
+		}
+		if sa.redactAll || sa.redact[strings.ToLower(key)] {
+			params[i] = name + "=" + redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func (sa *SlowRequestAspect) calculate() {
+	now := time.Now()
+	window := now.Sub(sa.windowStart)
+	sa.windowStart = now
+
+	sa.lock.Lock()
+	slowest := sa.slowest
+	sa.slowest = nil
+	sa.lock.Unlock()
+
+	requests := []SlowRequest(slowest)
+	if requests == nil {
+		requests = []SlowRequest{}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].DurationSeconds > requests[j].DurationSeconds
+	})
+
+	sa.lock.Lock()
+	sa.Stats = SlowRequestStats{
+		Requests:      requests,
+		WindowSeconds: window.Seconds(),
+		Timestamp:     now,
+	}
+	sa.lock.Unlock()
+}
+
+// slowHeap is a min heap of requests by duration, such that the
+// fastest of the slowest requests is replaced.
+type slowHeap []SlowRequest
+
+func (h slowHeap) Len() int            { return len(h) }
+func (h slowHeap) Less(i, j int) bool  { return h[i].DurationSeconds < h[j].DurationSeconds }
+func (h slowHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *slowHeap) Push(x interface{}) { *h = append(*h, x.(SlowRequest)) }
+
+func (h *slowHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,88 @@
+package ginmon
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SlowRequestHandler(t *testing.T) {
+	gin.SetMode(TestMode)
+	var logs bytes.Buffer
+	sa := NewSlowRequestAspect(2)
+	sa.SetThreshold(40 * time.Millisecond)
+	sa.SetLogger(slog.New(slog.NewJSONHandler(&logs, nil)))
+	router := gin.New()
+	router.Use(SlowRequestHandler(sa))
+	router.GET("/sleep/:ms", func(c *gin.Context) {
+		d, _ := time.ParseDuration(c.Param("ms") + "ms")
+		time.Sleep(d)
+	})
+
+	for _, ms := range []string{"1", "60", "5", "15"} {
+		req := httptest.NewRequest("GET", "/sleep/"+ms+"?user=bob&Token=secret", nil)
+		req.Header.Set("X-Request-Id", "req-"+ms)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	sa.calculate()
+	stats := sa.GetStats().(SlowRequestStats)
+
+	ids := make([]string, 0, len(stats.Requests))
+	for _, r := range stats.Requests {
+		ids = append(ids, r.RequestID)
+	}
+	expect := []string{"req-60", "req-15"}
+	if assert.Equal(t, expect, ids, "Slowest requests do not work, expect %v but got %v %s", expect, ids, ballotX) {
+		t.Logf("Slowest requests work, expected %v %s", ids, checkMark)
+	}
+	r := stats.Requests[0]
+	if assert.Equal(t, "/sleep/:ms", r.Route) && assert.Equal(t, http.StatusOK, r.Status) &&
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", r.TraceID, "Trace ID does not work %s", ballotX) {
+		t.Logf("SlowRequest works, expected %+v %s", r, checkMark)
+	}
+	if assert.Equal(t, "user=bob&Token=REDACTED", r.Query, "Redaction does not work, got %q %s", r.Query, ballotX) {
+		t.Logf("Redaction works, expected %q %s", r.Query, checkMark)
+	}
+
+	n := bytes.Count(logs.Bytes(), []byte("\n"))
+	assert.Equal(t, 1, n, "Only requests above the threshold should be logged, got %d lines %s", n, ballotX)
+	var line map[string]interface{}
+	if assert.NoError(t, json.Unmarshal(logs.Bytes(), &line)) &&
+		assert.Equal(t, "req-60", line["request_id"], "Log does not work, got %v %s", line, ballotX) {
+		t.Logf("Log works, expected %v %s", line["request_id"], checkMark)
+	}
+
+	sa.calculate()
+	stats = sa.GetStats().(SlowRequestStats)
+	if assert.Empty(t, stats.Requests, "Window reset does not work %s", ballotX) {
+		t.Logf("Window reset works %s", checkMark)
+	}
+}
+
+func Test_RedactQuery(t *testing.T) {
+	sa := NewSlowRequestAspect(1)
+	for _, tc := range []struct {
+		params []string
+		query  string
+		expect string
+	}{
+		{DefaultRedactedParams, "a=1&access_token=x&b", "a=1&access_token=REDACTED&b"},
+		{[]string{"*"}, "a=1&b=2", "a=REDACTED&b=REDACTED"},
+		{nil, "token=x", "token=x"},
+		{[]string{"my key"}, "my+key=x&my%20key=y", "my+key=REDACTED&my%20key=REDACTED"},
+	} {
+		sa.SetRedactedParams(tc.params...)
+		got := sa.redactQuery(tc.query)
+		if assert.Equal(t, tc.expect, got, "redactQuery does not work, expect %q but got %q %s", tc.expect, got, ballotX) {
+			t.Logf("redactQuery works, expected %q %s", got, checkMark)
+		}
+	}
+}
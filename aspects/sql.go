@@ -0,0 +1,486 @@
+package ginmon
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxStatementLength limits the length of normalized statements.
+const maxStatementLength = 256
+
+// SQLQueryData is the calculated data of one normalized statement.
+// Latency is measured in nanoseconds, for queries until the rows are
+// returned.
+type SQLQueryData struct {
+	Count   int                `json:"count"`
+	Errors  int                `json:"errors"`
+	Latency GenericChannelData `json:"latency"`
+}
+
+// SQLPoolStats are the connection pool stats of sql.DBStats. The wait
+// count and duration are totals, the deltas are the increase in the
+// time frame.
+type SQLPoolStats struct {
+	MaxOpen           int     `json:"max_open"`
+	Open              int     `json:"open"`
+	InUse             int     `json:"in_use"`
+	Idle              int     `json:"idle"`
+	WaitCount         int64   `json:"wait_count"`
+	WaitSeconds       float64 `json:"wait_seconds"`
+	WaitCountDelta    int64   `json:"wait_count_delta"`
+	WaitSecondsDelta  float64 `json:"wait_seconds_delta"`
+	MaxIdleClosed     int64   `json:"max_idle_closed"`
+	MaxLifetimeClosed int64   `json:"max_lifetime_closed"`
+}
+
+// SQLStats are the calculated data of all statements by normalized
+// statement and the pool stats of the DB set by SetDB.
+type SQLStats struct {
+	Queries       map[string]SQLQueryData `json:"queries"`
+	Pool          *SQLPoolStats           `json:"pool,omitempty"`
+	WindowSeconds float64                 `json:"window_seconds"`
+	Timestamp     time.Time               `json:"timestamp"`
+}
+
+// sqlWindow collects the statements of one normalized statement in a
+// time frame.
+type sqlWindow struct {
+	errors    int
+	latencies []float64
+}
+
+// SQLAspect records statements sent through the driver returned by
+// Driver or the connector returned by Connector.
+//
+// Example:
+//    	sqlAspect := ginmon.NewSQLAspect("SQL")
+//    	sqlAspect.StartTimer(time.Minute)
+//    	sql.Register("ginmon-postgres", sqlAspect.Driver(&pq.Driver{}))
+//    	db, err := sql.Open("ginmon-postgres", dsn)
+//    	sqlAspect.SetDB(db)
+type SQLAspect struct {
+	lock        sync.RWMutex
+	name        string
+	db          *sql.DB               // guarded by lock
+	windows     map[string]*sqlWindow // guarded by lock
+	prevWait    sql.DBStats           // only used by calculate
+	windowStart time.Time
+	Stats       SQLStats
+}
+
+// NewSQLAspect returns a new initialized SQLAspect, that is served as
+// name.
+func NewSQLAspect(name string) *SQLAspect {
+	return &SQLAspect{
+		name:        name,
+		windows:     make(map[string]*sqlWindow),
+		windowStart: time.Now(),
+		Stats:       SQLStats{Queries: make(map[string]SQLQueryData)},
+	}
+}
+
+// SetDB exposes the connection pool stats of db.
+func (sa *SQLAspect) SetDB(db *sql.DB) {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	sa.db = db
+}
+
+// StartTimer will call a forever loop in a goroutine to calculate
+// metrics for measurements every d ticks.
+func (sa *SQLAspect) StartTimer(d time.Duration) {
+	timer := time.Tick(d)
+	go func() {
+		for {
+			<-timer
+			sa.calculate()
+		}
+	}()
+}
+
+// GetStats to fulfill aspects.Aspect interface, it returns the data
+// that will be served as JSON.
+func (sa *SQLAspect) GetStats() interface{} {
+	sa.lock.RLock()
+	defer sa.lock.RUnlock()
+	return sa.Stats
+}
+
+// Name to fulfill aspects.Aspect interface, it will return the name
+// of the JSON object that will be served.
+func (sa *SQLAspect) Name() string {
+	return sa.name
+}
+
+// InRoot to fulfill aspects.Aspect interface, it will return where to
+// put the JSON object into the monitoring endpoint.
+func (sa *SQLAspect) InRoot() bool {
+	return false
+}
+
+var (
+	sqlStrings    = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlNumbers    = regexp.MustCompile(`(^|[^\w$])\d+(?:\.\d+)?\b`) // keeps placeholders like $1
+	sqlLists      = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+	sqlWhitespace = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeStatement replaces literals of query by ?, such that
+// statements that differ only by their values are counted together.
+func NormalizeStatement(query string) string {
+	s := sqlStrings.ReplaceAllString(query, "?")
+	s = sqlNumbers.ReplaceAllString(s, "${1}?")
+	s = sqlLists.ReplaceAllString(s, "(?)")
+	s = strings.TrimSpace(sqlWhitespace.ReplaceAllString(s, " "))
+	if len(s) > maxStatementLength {
+		s = s[:maxStatementLength]
+	}
+	return s
+}
+
+// record adds one statement, it is called by the driver wrappers.
+func (sa *SQLAspect) record(query string, start time.Time, err error) {
+	took := float64(time.Since(start))
+	key := NormalizeStatement(query)
+
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	w, ok := sa.windows[key]
+	if !ok {
+		w = &sqlWindow{}
+		sa.windows[key] = w
+	}
+	// ErrSkip asks database/sql to use another method, which is
+	// recorded itself
+	if err != nil && err != driver.ErrSkip {
+		w.errors++
+	}
+	w.latencies = append(w.latencies, took)
+}
+
+// calculate swaps the collected statements under lock and aggregates
+// them afterwards.
+func (sa *SQLAspect) calculate() {
+	now := time.Now()
+	window := now.Sub(sa.windowStart)
+	sa.windowStart = now
+
+	sa.lock.Lock()
+	windows := sa.windows
+	sa.windows = make(map[string]*sqlWindow, len(windows))
+	db := sa.db
+	sa.lock.Unlock()
+
+	stats := SQLStats{
+		Queries:       make(map[string]SQLQueryData, len(windows)),
+		WindowSeconds: window.Seconds(),
+		Timestamp:     now,
+	}
+	for key, w := range windows {
+		d := SQLQueryData{
+			Count:   len(w.latencies),
+			Errors:  w.errors,
+			Latency: distributionData(w.latencies),
+		}
+		d.Latency.Kind = KindDistribution.String()
+		d.Latency.WindowSeconds = window.Seconds()
+		d.Latency.RatePerSecond = perSecond(float64(d.Count), window)
+		d.Latency.Timestamp = now
+		stats.Queries[key] = d
+	}
+	if db != nil {
+		s := db.Stats()
+		stats.Pool = &SQLPoolStats{
+			MaxOpen:           s.MaxOpenConnections,
+			Open:              s.OpenConnections,
+			InUse:             s.InUse,
+			Idle:              s.Idle,
+			WaitCount:         s.WaitCount,
+			WaitSeconds:       s.WaitDuration.Seconds(),
+			WaitCountDelta:    s.WaitCount - sa.prevWait.WaitCount,
+			WaitSecondsDelta:  (s.WaitDuration - sa.prevWait.WaitDuration).Seconds(),
+			MaxIdleClosed:     s.MaxIdleClosed,
+			MaxLifetimeClosed: s.MaxLifetimeClosed,
+		}
+		sa.prevWait = s
+	}
+
+	sa.lock.Lock()
+	sa.Stats = stats
+	sa.lock.Unlock()
+}
+
+// Driver returns a driver.Driver, that records all statements of d.
+// Register it with sql.Register to use it with sql.Open.
+func (sa *SQLAspect) Driver(d driver.Driver) driver.Driver {
+	return &sqlDriver{sa: sa, d: d}
+}
+
+// Connector returns a driver.Connector, that records all statements
+// of c, to be used with sql.OpenDB.
+func (sa *SQLAspect) Connector(c driver.Connector) driver.Connector {
+	return &sqlConnector{sa: sa, c: c}
+}
+
+type sqlDriver struct {
+	sa *SQLAspect
+	d  driver.Driver
+}
+
+func (d *sqlDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.d.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlConn{sa: d.sa, c: c}, nil
+}
+
+type sqlConnector struct {
+	sa *SQLAspect
+	c  driver.Connector
+}
+
+func (c *sqlConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.c.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlConn{sa: c.sa, c: conn}, nil
+}
+
+func (c *sqlConnector) Driver() driver.Driver {
+	return &sqlDriver{sa: c.sa, d: c.c.Driver()}
+}
+
+// sqlConn wraps a driver.Conn. Optional interfaces of the wrapped
+// connection are used if implemented, otherwise database/sql falls
+// back like for drivers without them.
+type sqlConn struct {
+	sa *SQLAspect
+	c  driver.Conn
+}
+
+func (c *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	s, err := c.c.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStmt{sa: c.sa, s: s, query: query}, nil
+}
+
+func (c *sqlConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	pc, ok := c.c.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+	s, err := pc.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStmt{sa: c.sa, s: s, query: query}, nil
+}
+
+func (c *sqlConn) Close() error {
+	return c.c.Close()
+}
+
+func (c *sqlConn) Begin() (driver.Tx, error) {
+	return c.c.Begin()
+}
+
+// BeginTx falls back to Begin like database/sql, if the driver does
+// not support options, non-default options fail.
+func (c *sqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if bt, ok := c.c.(driver.ConnBeginTx); ok {
+		return bt.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, errors.New("sql: driver does not support non-default isolation level")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support read-only transactions")
+	}
+	tx, err := c.c.Begin()
+	if err == nil && ctx.Err() != nil {
+		tx.Rollback()
+		return nil, ctx.Err()
+	}
+	return tx, err
+}
+
+func (c *sqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.c.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := ec.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.sa.record(query, start, err)
+	}
+	return res, err
+}
+
+func (c *sqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.c.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.sa.record(query, start, err)
+	}
+	return rows, err
+}
+
+func (c *sqlConn) Ping(ctx context.Context) error {
+	if p, ok := c.c.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *sqlConn) ResetSession(ctx context.Context) error {
+	if sr, ok := c.c.(driver.SessionResetter); ok {
+		return sr.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *sqlConn) IsValid() bool {
+	if v, ok := c.c.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue leaves arguments to the statement, if the driver
+// can neither exec nor query without one, such that its checker or
+// column converter is used after ExecContext or QueryContext skipped.
+func (c *sqlConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := c.c.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	_, ec := c.c.(driver.ExecerContext)
+	_, qc := c.c.(driver.QueryerContext)
+	if !ec && !qc {
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// sqlStmt wraps a driver.Stmt.
+type sqlStmt struct {
+	sa    *SQLAspect
+	s     driver.Stmt
+	query string
+}
+
+func (s *sqlStmt) Close() error {
+	return s.s.Close()
+}
+
+func (s *sqlStmt) NumInput() int {
+	return s.s.NumInput()
+}
+
+func (s *sqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	start := time.Now()
+	res, err := s.s.Exec(args)
+	s.sa.record(s.query, start, err)
+	return res, err
+}
+
+func (s *sqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.s.Query(args)
+	s.sa.record(s.query, start, err)
+	return rows, err
+}
+
+func (s *sqlStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	sec, ok := s.s.(driver.StmtExecContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Exec(values)
+	}
+	start := time.Now()
+	res, err := sec.ExecContext(ctx, args)
+	s.sa.record(s.query, start, err)
+	return res, err
+}
+
+func (s *sqlStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	sqc, ok := s.s.(driver.StmtQueryContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Query(values)
+	}
+	start := time.Now()
+	rows, err := sqc.QueryContext(ctx, args)
+	s.sa.record(s.query, start, err)
+	return rows, err
+}
+
+// CheckNamedValue uses the checker or, like database/sql, the column
+// converter of the wrapped statement, since the wrapper hides them.
+func (s *sqlStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := s.s.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	cc, ok := s.s.(driver.ColumnConverter)
+	if !ok {
+		return driver.ErrSkip
+	}
+	// database/sql reports too many arguments
+	index := nv.Ordinal - 1
+	if n := s.s.NumInput(); n != -1 && index >= n {
+		return nil
+	}
+	if vr, ok := nv.Value.(driver.Valuer); ok {
+		v, err := vr.Value()
+		if err != nil {
+			return err
+		}
+		if !driver.IsValue(v) {
+			return fmt.Errorf("ginmon: non-subset type %T returned from Value", v)
+		}
+		nv.Value = v
+	}
+	v, err := cc.ColumnConverter(index).ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	if !driver.IsValue(v) {
+		return fmt.Errorf("ginmon: driver ColumnConverter converted %T to unsupported type %T", nv.Value, v)
+	}
+	nv.Value = v
+	return nil
+}
+
+// namedValuesToValues converts arguments for drivers without context
+// support, which do not support named arguments.
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("ginmon: driver does not support named argument %s", arg.Name)
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
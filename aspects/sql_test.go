@@ -0,0 +1,205 @@
+package ginmon
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver is an in-memory driver without optional interfaces,
+// statements containing "fail" return an error.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(ctx context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                            { return fakeDriver{} }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt(query), nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeStmt string
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if strings.Contains(string(s), "fail") {
+		return nil, errors.New("fail")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if strings.Contains(string(s), "fail") {
+		return nil, errors.New("fail")
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct{ done bool }
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+// point is converted only by the column converter of convStmt.
+type point struct{ x, y int }
+
+type convConnector struct{}
+
+func (convConnector) Connect(ctx context.Context) (driver.Conn, error) { return convConn{}, nil }
+func (convConnector) Driver() driver.Driver                            { return fakeDriver{} }
+
+type convConn struct{ fakeConn }
+
+func (convConn) Prepare(query string) (driver.Stmt, error) { return convStmt{fakeStmt(query)}, nil }
+
+type convStmt struct{ fakeStmt }
+
+func (convStmt) ColumnConverter(int) driver.ValueConverter { return pointConverter{} }
+
+func (s convStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if len(args) != 1 || args[0] != "1,2" {
+		return nil, fmt.Errorf("unconverted arguments %v", args)
+	}
+	return s.fakeStmt.Exec(args)
+}
+
+type pointConverter struct{}
+
+func (pointConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	if p, ok := v.(point); ok {
+		return fmt.Sprintf("%d,%d", p.x, p.y), nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func Test_NormalizeStatement(t *testing.T) {
+	for query, expect := range map[string]string{
+		"SELECT * FROM t WHERE id = 42":                  "SELECT * FROM t WHERE id = ?",
+		"SELECT *\n  FROM t WHERE name = 'it''s'":        "SELECT * FROM t WHERE name = ?",
+		"SELECT * FROM t WHERE id IN (1, 2, 3)":          "SELECT * FROM t WHERE id IN (?)",
+		"SELECT * FROM t2 WHERE id = $1 AND x = 1.5":     "SELECT * FROM t2 WHERE id = $1 AND x = ?",
+		"INSERT INTO t (a, b) VALUES ('x', 2), ('y', 3)": "INSERT INTO t (a, b) VALUES (?), (?)",
+	} {
+		got := NormalizeStatement(query)
+		if assert.Equal(t, expect, got, "NormalizeStatement does not work, expect %q but got %q %s", expect, got, ballotX) {
+			t.Logf("NormalizeStatement works, expected %q %s", got, checkMark)
+		}
+	}
+}
+
+func Test_SQLBeginTx(t *testing.T) {
+	db := sql.OpenDB(NewSQLAspect("SQL").Connector(fakeConnector{}))
+	defer db.Close()
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if assert.NoError(t, err, "BeginTx with default options should use Begin %s", ballotX) {
+		tx.Rollback()
+		t.Logf("BeginTx with default options uses Begin %s", checkMark)
+	}
+	for name, opts := range map[string]*sql.TxOptions{
+		"isolation level": {Isolation: sql.LevelSerializable},
+		"read-only":       {ReadOnly: true},
+	} {
+		if _, err := db.BeginTx(ctx, opts); assert.Error(t, err, "BeginTx with %s should fail %s", name, ballotX) {
+			t.Logf("BeginTx with %s fails %s", name, checkMark)
+		}
+	}
+}
+
+func Test_SQLColumnConverter(t *testing.T) {
+	db := sql.OpenDB(NewSQLAspect("SQL").Connector(convConnector{}))
+	defer db.Close()
+	_, err := db.Exec("UPDATE t SET p = ?", point{1, 2})
+	if assert.NoError(t, err, "ColumnConverter of the driver should be used %s", ballotX) {
+		t.Logf("ColumnConverter of the driver is used %s", checkMark)
+	}
+	stmt, err := db.Prepare("UPDATE t SET p = ?")
+	if assert.NoError(t, err) {
+		defer stmt.Close()
+		_, err = stmt.Exec(point{1, 2})
+		if assert.NoError(t, err, "ColumnConverter of a prepared statement should be used %s", ballotX) {
+			t.Logf("ColumnConverter of a prepared statement is used %s", checkMark)
+		}
+	}
+}
+
+func Test_SQLAspectSingleQuery(t *testing.T) {
+	sa := NewSQLAspect("SQL")
+	db := sql.OpenDB(sa.Connector(fakeConnector{}))
+	defer db.Close()
+	_, err := db.Exec("UPDATE t SET x = 'y'")
+	assert.NoError(t, err)
+	sa.calculate()
+	_, err = json.Marshal(sa.GetStats())
+	if assert.NoError(t, err, "Stats of one query should be encoded %s", ballotX) {
+		t.Logf("Stats of one query are encoded %s", checkMark)
+	}
+}
+
+func Test_SQLAspect(t *testing.T) {
+	sa := NewSQLAspect("SQL")
+	db := sql.OpenDB(sa.Connector(fakeConnector{}))
+	defer db.Close()
+	sa.SetDB(db)
+
+	for _, id := range []string{"1", "2", "3"} {
+		var n int
+		err := db.QueryRow("SELECT id FROM t WHERE id = " + id).Scan(&n)
+		assert.NoError(t, err)
+	}
+	_, err := db.Exec("UPDATE t SET x = 'y'")
+	assert.NoError(t, err)
+	_, err = db.Exec("UPDATE fail")
+	assert.Error(t, err)
+
+	sa.calculate()
+	stats := sa.GetStats().(SQLStats)
+
+	d := stats.Queries["SELECT id FROM t WHERE id = ?"]
+	if assert.Equal(t, 3, d.Count, "Count does not work, expect %d but got %d %s", 3, d.Count, ballotX) {
+		t.Logf("Count works, expected %d %s", d.Count, checkMark)
+	}
+	if assert.Equal(t, 3, d.Latency.Count) && assert.True(t, d.Latency.Max > 0, "Latency does not work %s", ballotX) {
+		t.Logf("Latency works %s", checkMark)
+	}
+	d = stats.Queries["UPDATE fail"]
+	if assert.Equal(t, 1, d.Errors, "Errors does not work, expect %d but got %d %s", 1, d.Errors, ballotX) {
+		t.Logf("Errors works, expected %d %s", d.Errors, checkMark)
+	}
+	if assert.Equal(t, 0, stats.Queries["UPDATE t SET x = ?"].Errors) {
+		t.Logf("Successful statements have no errors %s", checkMark)
+	}
+	if assert.NotNil(t, stats.Pool, "Pool does not work %s", ballotX) &&
+		assert.Equal(t, 1, stats.Pool.Open, "Pool does not work, expect %d but got %d %s", 1, stats.Pool.Open, ballotX) {
+		t.Logf("Pool works, expected %d open %s", stats.Pool.Open, checkMark)
+	}
+}
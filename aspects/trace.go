@@ -0,0 +1,50 @@
+package ginmon
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultTraceIDHeader is the default header of the trace ID of
+// exemplars and slow requests, a W3C traceparent header.
+const DefaultTraceIDHeader = "traceparent"
+
+// maxTraceIDLength limits trace IDs, such that exemplars stay below
+// the 128 characters allowed by OpenMetrics.
+const maxTraceIDLength = 64
+
+// traceID returns the trace ID of the header of r. The trace-id of a
+// W3C traceparent header, version-traceid-parentid-flags, is returned.
+// Values of other headers are only returned if validTraceID accepts
+// them.
+func traceID(r *http.Request, header string) string {
+	v := r.Header.Get(header)
+	if !strings.EqualFold(header, "traceparent") {
+		if !validTraceID(v) {
+			return ""
+		}
+		return v
+	}
+	parts := strings.Split(v, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	return parts[1]
+}
+
+// validTraceID returns true if id has at most maxTraceIDLength
+// letters, digits or any of "-_.:".
+func validTraceID(id string) bool {
+	if id == "" || len(id) > maxTraceIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
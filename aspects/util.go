@@ -1,14 +1,26 @@
 package ginmon
 
-import "math"
+import (
+	"math"
+	"time"
+)
 
-func mean(orderedObservations []float64, l int) float64 {
+func sum(observations []float64, l int) float64 {
 	res := 0.0
 	for i := 0; i < l; i++ {
-		res += orderedObservations[i]
+		res += observations[i]
 	}
 
-	return res / float64(l)
+	return res
+}
+
+// perSecond returns n divided by the length of window in seconds, or 0
+// for an empty window.
+func perSecond(n float64, window time.Duration) float64 {
+	if window <= 0 {
+		return 0
+	}
+	return n / window.Seconds()
 }
 
 func p90(orderedObservations []float64, l int) float64 {
@@ -30,7 +42,12 @@ func percentile(orderedObservations []float64, l int, p float64) float64 {
 	return orderedObservations[int(p*float64(l))]
 }
 
+// correctedStdev returns the corrected standard deviation of the
+// first l observations, which is 0 for less than two observations.
 func correctedStdev(observations []float64, mean float64, l int) float64 {
+	if l < 2 {
+		return 0
+	}
 	var omega float64
 	for i := 0; i < l; i++ {
 		omega += math.Pow(observations[i]-mean, 2)
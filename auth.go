@@ -0,0 +1,250 @@
+package gomonitor
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RejectedName is the name of the aspect that counts the requests
+// rejected by Auth, by reason "unauthorized" (401) and "forbidden"
+// (403).
+//
+// Example:
+//    % curl -u monitor:secret http://localhost:9000/Rejected
+const RejectedName = "Rejected"
+
+// Auth protects the monitor endpoint. Requests have to come from one
+// of AllowedNetworks, if set, and have to pass basic auth or send one
+// of the bearer tokens, if BasicUsers or Tokens are set.
+type Auth struct {
+	// BasicUsers maps user names to passwords for HTTP basic auth.
+	BasicUsers map[string]string
+	// Tokens returns the valid bearer tokens, it is called for each
+	// request, such that tokens can be rotated without restart. Bearer
+	// tokens are rejected if it returns an error.
+	Tokens TokenSource
+	// AllowedNetworks are CIDRs like "10.0.0.0/8" or "::1/128".
+	AllowedNetworks []string
+}
+
+// TokenSource returns the currently valid bearer tokens.
+type TokenSource interface {
+	Tokens() ([]string, error)
+}
+
+// StaticTokens is a TokenSource of fixed tokens.
+type StaticTokens []string
+
+// Tokens to fulfill TokenSource interface.
+func (st StaticTokens) Tokens() ([]string, error) {
+	return st, nil
+}
+
+type envTokens string
+
+// TokensFromEnv returns a TokenSource, that reads the comma separated
+// tokens of the environment variable name on each request.
+func TokensFromEnv(name string) TokenSource {
+	return envTokens(name)
+}
+
+func (et envTokens) Tokens() ([]string, error) {
+	return splitTokens(strings.Split(os.Getenv(string(et)), ",")), nil
+}
+
+// fileTokens reads tokens from a file, which is read again if it was
+// changed.
+type fileTokens struct {
+	sync.Mutex
+	file    string
+	modTime time.Time
+	cached  []string
+}
+
+// TokensFromFile returns a TokenSource, that reads one token per line
+// of file. The file is read again if it was changed, lines starting
+// with # are skipped. If the file can not be read, no token is valid.
+func TokensFromFile(file string) TokenSource {
+	return &fileTokens{file: file}
+}
+
+func (ft *fileTokens) Tokens() ([]string, error) {
+	ft.Lock()
+	defer ft.Unlock()
+
+	fi, err := os.Stat(ft.file)
+	if err != nil {
+		return ft.fail(err)
+	}
+	if fi.ModTime().Equal(ft.modTime) {
+		return ft.cached, nil
+	}
+
+	f, err := os.Open(ft.file)
+	if err != nil {
+		return ft.fail(err)
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return ft.fail(err)
+	}
+	ft.cached = splitTokens(lines)
+	ft.modTime = fi.ModTime()
+	return ft.cached, nil
+}
+
+// fail drops the cached tokens, such that the file is read again by
+// the next call.
+func (ft *fileTokens) fail(err error) ([]string, error) {
+	ft.cached = nil
+	ft.modTime = time.Time{}
+	return nil, err
+}
+
+// splitTokens trims tokens and skips empty tokens and comments.
+func splitTokens(lines []string) []string {
+	var tokens []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	return tokens
+}
+
+// authHandler rejects requests, that do not pass Auth, before they
+// reach next.
+type authHandler struct {
+	auth     *Auth
+	networks []*net.IPNet
+	next     http.Handler
+	rejected *rejectedAspect
+}
+
+func newAuthHandler(auth *Auth) (*authHandler, error) {
+	ah := &authHandler{auth: auth, rejected: &rejectedAspect{}}
+	for _, cidr := range auth.AllowedNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed network: %v", err)
+		}
+		ah.networks = append(ah.networks, network)
+	}
+	return ah, nil
+}
+
+func (ah *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !ah.allowed(r) {
+		atomic.AddUint64(&ah.rejected.forbidden, 1)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	if !ah.authenticated(r) {
+		atomic.AddUint64(&ah.rejected.unauthorized, 1)
+		if ah.auth.BasicUsers != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gomonitor"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gomonitor"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	ah.next.ServeHTTP(w, r)
+}
+
+// allowed returns true if no networks are configured or the remote
+// address is in one of them.
+func (ah *authHandler) allowed(r *http.Request) bool {
+	if len(ah.networks) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range ah.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticated returns true if no credentials are configured or the
+// request has valid basic auth or bearer token.
+func (ah *authHandler) authenticated(r *http.Request) bool {
+	if ah.auth.BasicUsers == nil && ah.auth.Tokens == nil {
+		return true
+	}
+
+	if user, password, ok := r.BasicAuth(); ok && ah.auth.BasicUsers != nil {
+		expect, found := ah.auth.BasicUsers[user]
+		return found && equal(password, expect)
+	}
+
+	header := r.Header.Get("Authorization")
+	if ah.auth.Tokens == nil || !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	tokens, err := ah.auth.Tokens.Tokens()
+	if err != nil {
+		return false
+	}
+	valid := false
+	for _, t := range tokens {
+		if equal(token, t) {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// equal compares in constant time to not leak secrets by timing.
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// rejectedAspect counts the requests rejected by authHandler.
+type rejectedAspect struct {
+	unauthorized uint64
+	forbidden    uint64
+}
+
+// GetStats to fulfill aspects.Aspect interface, it returns the number
+// of rejected requests by reason.
+func (ra *rejectedAspect) GetStats() interface{} {
+	return map[string]uint64{
+		"unauthorized": atomic.LoadUint64(&ra.unauthorized),
+		"forbidden":    atomic.LoadUint64(&ra.forbidden),
+	}
+}
+
+// Name to fulfill aspects.Aspect interface.
+func (ra *rejectedAspect) Name() string {
+	return RejectedName
+}
+
+// InRoot to fulfill aspects.Aspect interface.
+func (ra *rejectedAspect) InRoot() bool {
+	return false
+}
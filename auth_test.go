@@ -0,0 +1,119 @@
+package gomonitor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAuthHandler(t *testing.T, auth *Auth) *authHandler {
+	ah, err := newAuthHandler(auth)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	ah.next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return ah
+}
+
+func Test_Auth(t *testing.T) {
+	os.Setenv("GOMONITOR_TEST_TOKENS", "token1, token2")
+	defer os.Unsetenv("GOMONITOR_TEST_TOKENS")
+	ah := newTestAuthHandler(t, &Auth{
+		BasicUsers:      map[string]string{"monitor": "secret"},
+		Tokens:          TokensFromEnv("GOMONITOR_TEST_TOKENS"),
+		AllowedNetworks: []string{"10.0.0.0/8", "::1/128"},
+	})
+
+	for _, tc := range []struct {
+		name       string
+		remoteAddr string
+		setup      func(r *http.Request)
+		expect     int
+	}{
+		{"basic auth", "10.1.2.3:1234", func(r *http.Request) { r.SetBasicAuth("monitor", "secret") }, http.StatusOK},
+		{"bearer token", "[::1]:1234", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token2") }, http.StatusOK},
+		{"wrong password", "10.1.2.3:1234", func(r *http.Request) { r.SetBasicAuth("monitor", "guess") }, http.StatusUnauthorized},
+		{"wrong token", "10.1.2.3:1234", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token3") }, http.StatusUnauthorized},
+		{"no credentials", "10.1.2.3:1234", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"other network", "192.168.1.1:1234", func(r *http.Request) { r.SetBasicAuth("monitor", "secret") }, http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		tc.setup(req)
+		rec := httptest.NewRecorder()
+		ah.ServeHTTP(rec, req)
+		if assert.Equal(t, tc.expect, rec.Code, "%s does not work, expect %d but got %d %s",
+			tc.name, tc.expect, rec.Code, ballotX) {
+			t.Logf("%s works, expected %d %s", tc.name, rec.Code, checkMark)
+		}
+	}
+
+	expect := map[string]uint64{"unauthorized": 3, "forbidden": 1}
+	if assert.Equal(t, expect, ah.rejected.GetStats(), "Rejected does not work, expect %v but got %v %s",
+		expect, ah.rejected.GetStats(), ballotX) {
+		t.Logf("Rejected works, expected %v %s", ah.rejected.GetStats(), checkMark)
+	}
+
+	_, err := newAuthHandler(&Auth{AllowedNetworks: []string{"10.0.0.0"}})
+	if assert.Error(t, err, "Invalid network should fail %s", ballotX) {
+		t.Logf("Invalid network fails %s", checkMark)
+	}
+}
+
+func Test_TokensFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomonitor")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "tokens")
+
+	write := func(content string, mtime time.Time) {
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0600))
+		assert.NoError(t, os.Chtimes(file, mtime, mtime))
+	}
+
+	write("# comment\nold\n", time.Now().Add(-time.Minute))
+	ts := TokensFromFile(file)
+	tokens, err := ts.Tokens()
+	if assert.NoError(t, err) && assert.Equal(t, []string{"old"}, tokens, "Tokens does not work, expect %v but got %v %s",
+		[]string{"old"}, tokens, ballotX) {
+		t.Logf("Tokens works, expected %v %s", tokens, checkMark)
+	}
+
+	write("new\n", time.Now())
+	tokens, err = ts.Tokens()
+	if assert.NoError(t, err) && assert.Equal(t, []string{"new"}, tokens, "Rotation does not work, expect %v but got %v %s",
+		[]string{"new"}, tokens, ballotX) {
+		t.Logf("Rotation works, expected %v %s", tokens, checkMark)
+	}
+
+	ah := newTestAuthHandler(t, &Auth{Tokens: ts})
+	request := func() int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer new")
+		rec := httptest.NewRecorder()
+		ah.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := request(); assert.Equal(t, http.StatusOK, code, "Token of the file should be valid %s", ballotX) {
+		t.Logf("Token of the file is valid %s", checkMark)
+	}
+
+	os.Remove(file)
+	tokens, err = ts.Tokens()
+	if assert.Error(t, err) && assert.Empty(t, tokens, "Tokens of a removed file should be dropped %s", ballotX) {
+		t.Logf("Tokens of a removed file are dropped %s", checkMark)
+	}
+	if code := request(); assert.Equal(t, http.StatusUnauthorized, code, "Token of a removed file should be rejected %s", ballotX) {
+		t.Logf("Token of a removed file is rejected %s", checkMark)
+	}
+}
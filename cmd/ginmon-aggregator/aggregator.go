@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/szuecs/gin-gomonitor/aspects"
+	"gopkg.in/mcuadros/go-monitor.v1/aspects"
+)
+
+// TargetsName is the name of the aspect that shows the state of all
+// scraped endpoints.
+const TargetsName = "Targets"
+
+// targetStatus is the state of one endpoint after the last scrape.
+type targetStatus struct {
+	Up         bool      `json:"up"`
+	Error      string    `json:"error,omitempty"`
+	LastScrape time.Time `json:"last_scrape"`
+}
+
+// aggregator scrapes aspects of many monitor endpoints and merges
+// them into one view.
+type aggregator struct {
+	client      *http.Client
+	targets     *targetList
+	aspectNames []string
+
+	mu     sync.RWMutex
+	status map[string]targetStatus
+	merged map[string]interface{}
+}
+
+func newAggregator(client *http.Client, targets *targetList, aspectNames []string) *aggregator {
+	return &aggregator{
+		client:      client,
+		targets:     targets,
+		aspectNames: aspectNames,
+		status:      make(map[string]targetStatus),
+		merged:      make(map[string]interface{}),
+	}
+}
+
+// Aspects returns the aspects to expose the merged view with
+// gomonitor.Start.
+func (a *aggregator) Aspects() []aspects.Aspect {
+	asps := []aspects.Aspect{&targetsAspect{a}}
+	for _, name := range a.aspectNames {
+		asps = append(asps, &mergedAspect{a: a, name: name})
+	}
+	return asps
+}
+
+// Run scrapes all endpoints every d until stop is closed.
+func (a *aggregator) Run(d time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		a.scrape()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// scrape fetches all aspects of all endpoints concurrently and merges
+// the data of the reachable endpoints.
+func (a *aggregator) scrape() {
+	targets, err := a.targets.Targets()
+	if err != nil {
+		log.Printf("Failed to read targets: %v", err)
+	}
+
+	results := make([]map[string]json.RawMessage, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			results[i], errs[i] = a.fetch(target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	status := make(map[string]targetStatus, len(targets))
+	perAspect := make(map[string][]json.RawMessage)
+	for i, target := range targets {
+		if errs[i] != nil {
+			status[target] = targetStatus{Error: errs[i].Error(), LastScrape: now}
+			continue
+		}
+		status[target] = targetStatus{Up: true, LastScrape: now}
+		for name, raw := range results[i] {
+			perAspect[name] = append(perAspect[name], raw)
+		}
+	}
+
+	merged := make(map[string]interface{}, len(perAspect))
+	for name, raws := range perAspect {
+		v, err := mergeAspect(raws)
+		if err != nil {
+			log.Printf("Failed to merge aspect %s: %v", name, err)
+			continue
+		}
+		merged[name] = v
+	}
+
+	a.mu.Lock()
+	a.status = status
+	a.merged = merged
+	a.mu.Unlock()
+}
+
+// fetch returns the raw JSON of all configured aspects of target.
+// Aspects that are not exposed by target are skipped.
+func (a *aggregator) fetch(target string) (map[string]json.RawMessage, error) {
+	res := make(map[string]json.RawMessage, len(a.aspectNames))
+	for _, name := range a.aspectNames {
+		resp, err := a.client.Get(target + "/" + name)
+		if err != nil {
+			return nil, err
+		}
+		var body map[string]json.RawMessage
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s/%s returned %s", target, name, resp.Status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s/%s: %v", target, name, err)
+		}
+		if raw, ok := body[name]; ok && string(raw) != "null" {
+			res[name] = raw
+		}
+	}
+	return res, nil
+}
+
+// mergeAspect detects the type of the aspect by its JSON keys and
+// merges the data of all endpoints.
+func mergeAspect(raws []json.RawMessage) (interface{}, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(raws[0], &keys); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case keys["request_sum_per_minute"] != nil:
+		counters := make([]ginmon.CounterAspect, len(raws))
+		for i, raw := range raws {
+			if err := json.Unmarshal(raw, &counters[i]); err != nil {
+				return nil, err
+			}
+		}
+		return mergeCounters(counters), nil
+	case keys["p99"] != nil:
+		rts := make([]ginmon.RequestTimeStats, len(raws))
+		for i, raw := range raws {
+			if err := json.Unmarshal(raw, &rts[i]); err != nil {
+				return nil, err
+			}
+		}
+		return mergeRequestTimes(rts), nil
+	default:
+		generics := make([]ginmon.GenericChannelStats, len(raws))
+		for i, raw := range raws {
+			if err := json.Unmarshal(raw, &generics[i]); err != nil {
+				return nil, err
+			}
+		}
+		return mergeGenerics(generics), nil
+	}
+}
+
+func mergeCounters(counters []ginmon.CounterAspect) ginmon.CounterAspect {
+	res := ginmon.CounterAspect{
+		Requests:     make(map[string]int),
+		RequestCodes: make(map[int]int),
+	}
+	for _, c := range counters {
+		res.RequestsSum += c.RequestsSum
+		for path, n := range c.Requests {
+			res.Requests[path] += n
+		}
+		for code, n := range c.RequestCodes {
+			res.RequestCodes[code] += n
+		}
+	}
+	return res
+}
+
+func mergeRequestTimes(rts []ginmon.RequestTimeStats) ginmon.RequestTimeStats {
+	data := make([]ginmon.GenericChannelData, len(rts))
+	for i, rt := range rts {
+		data[i] = ginmon.GenericChannelData{
+			Count:         rt.Count,
+			Sum:           rt.Sum,
+			RatePerSecond: rt.RatePerSecond,
+			WindowSeconds: rt.WindowSeconds,
+			SampleRate:    rt.SampleRate,
+			Min:           rt.Min,
+			Max:           rt.Max,
+			Mean:          rt.Mean,
+			Stdev:         rt.Stdev,
+			P90:           rt.P90,
+			P95:           rt.P95,
+			P99:           rt.P99,
+			Timestamp:     rt.Timestamp,
+			Histogram:     rt.Histogram,
+		}
+	}
+
+	d := mergeDistributions(data)
+	return ginmon.RequestTimeStats{
+		Count:         d.Count,
+		Sum:           d.Sum,
+		RatePerSecond: d.RatePerSecond,
+		WindowSeconds: d.WindowSeconds,
+		SampleRate:    d.SampleRate,
+		Min:           d.Min,
+		Max:           d.Max,
+		Mean:          d.Mean,
+		Stdev:         d.Stdev,
+		P90:           d.P90,
+		P95:           d.P95,
+		P99:           d.P99,
+		Timestamp:     d.Timestamp,
+		Histogram:     d.Histogram,
+	}
+}
+
+// mergeGenerics merges the data of each name by its kind. Counters
+// and gauges are summed up, distributions are merged by
+// mergeDistributions. Dropped values and removed names are summed up.
+func mergeGenerics(generics []ginmon.GenericChannelStats) ginmon.GenericChannelStats {
+	res := ginmon.GenericChannelStats{}
+	perName := make(map[string][]ginmon.GenericChannelData)
+	for _, g := range generics {
+		for name, gcd := range g.Metrics {
+			perName[name] = append(perName[name], gcd)
+		}
+		res.Dropped += g.Dropped
+		res.Expired += g.Expired
+		res.Evicted += g.Evicted
+		res.WindowSeconds = math.Max(res.WindowSeconds, g.WindowSeconds)
+		if g.Timestamp.After(res.Timestamp) {
+			res.Timestamp = g.Timestamp
+		}
+	}
+
+	res.Metrics = make(map[string]ginmon.GenericChannelData, len(perName))
+	for name, data := range perName {
+		if data[0].Kind == ginmon.KindDistribution.String() || data[0].Kind == "" {
+			res.Metrics[name] = mergeDistributions(data)
+			continue
+		}
+
+		gcd := mergeCommon(data)
+		for _, d := range data {
+			gcd.Value += d.Value
+		}
+		res.Metrics[name] = gcd
+	}
+	return res
+}
+
+// mergeCommon sums up count, sum and rate, and takes min and max of
+// all data with a count.
+func mergeCommon(data []ginmon.GenericChannelData) ginmon.GenericChannelData {
+	res := ginmon.GenericChannelData{Kind: data[0].Kind}
+	// the rate of all endpoints is the share of recorded observations
+	var sampled float64
+	for _, d := range data {
+		if d.Count > 0 {
+			if res.Count == 0 || d.Min < res.Min {
+				res.Min = d.Min
+			}
+			if res.Count == 0 || d.Max > res.Max {
+				res.Max = d.Max
+			}
+		}
+		res.Count += d.Count
+		res.Sum += d.Sum
+		res.RatePerSecond += d.RatePerSecond
+		res.WindowSeconds = math.Max(res.WindowSeconds, d.WindowSeconds)
+		if d.Timestamp.After(res.Timestamp) {
+			res.Timestamp = d.Timestamp
+		}
+		sampled += float64(d.Count) * sampleRate(d.SampleRate)
+	}
+	res.SampleRate = 1
+	if res.Count > 0 {
+		res.SampleRate = sampled / float64(res.Count)
+	}
+	return res
+}
+
+// sampleRate returns rate, or 1 for endpoints without sampling.
+func sampleRate(rate float64) float64 {
+	if rate <= 0 {
+		return 1
+	}
+	return rate
+}
+
+// mergeDistributions calculates exact count, sum, mean and stdev of
+// all data. Percentiles are calculated from the merged histograms if
+// all endpoints expose them, otherwise the maximum of all percentiles
+// is used as upper bound.
+func mergeDistributions(data []ginmon.GenericChannelData) ginmon.GenericChannelData {
+	res := mergeCommon(data)
+	if res.Count == 0 {
+		return res
+	}
+	res.Mean = res.Sum / float64(res.Count)
+
+	// sum of squares of each endpoint from its mean and stdev
+	var sumOfSquares float64
+	histograms := make([]*ginmon.Histogram, 0, len(data))
+	exact := true
+	for _, d := range data {
+		if d.Count == 0 {
+			continue
+		}
+		n := float64(d.Count)
+		sumOfSquares += (n-1)*d.Stdev*d.Stdev + n*d.Mean*d.Mean
+		res.P90 = math.Max(res.P90, d.P90)
+		res.P95 = math.Max(res.P95, d.P95)
+		res.P99 = math.Max(res.P99, d.P99)
+		if d.Histogram == nil {
+			exact = false
+		}
+		histograms = append(histograms, d.Histogram)
+	}
+	if n := float64(res.Count); n > 1 {
+		res.Stdev = math.Sqrt(math.Max(0, (sumOfSquares-n*res.Mean*res.Mean)/(n-1)))
+	}
+
+	if exact {
+		if h, err := ginmon.Merge(histograms...); err == nil {
+			res.P90 = h.Quantile(0.9)
+			res.P95 = h.Quantile(0.95)
+			res.P99 = h.Quantile(0.99)
+			res.Histogram = h
+		}
+	}
+	return res
+}
+
+// mergedAspect exposes the merged data of one aspect.
+type mergedAspect struct {
+	a    *aggregator
+	name string
+}
+
+// GetStats to fulfill aspects.Aspect interface, it returns the merged
+// data of all reachable endpoints.
+func (ma *mergedAspect) GetStats() interface{} {
+	ma.a.mu.RLock()
+	defer ma.a.mu.RUnlock()
+	return ma.a.merged[ma.name]
+}
+
+// Name to fulfill aspects.Aspect interface, it uses the name of the
+// scraped aspect.
+func (ma *mergedAspect) Name() string {
+	return ma.name
+}
+
+// InRoot to fulfill aspects.Aspect interface.
+func (ma *mergedAspect) InRoot() bool {
+	return false
+}
+
+// targetsAspect exposes the state of all endpoints.
+type targetsAspect struct {
+	a *aggregator
+}
+
+// GetStats to fulfill aspects.Aspect interface, it returns the state
+// of all endpoints after the last scrape.
+func (ta *targetsAspect) GetStats() interface{} {
+	ta.a.mu.RLock()
+	defer ta.a.mu.RUnlock()
+	return ta.a.status
+}
+
+// Name to fulfill aspects.Aspect interface.
+func (ta *targetsAspect) Name() string {
+	return TargetsName
+}
+
+// InRoot to fulfill aspects.Aspect interface.
+func (ta *targetsAspect) InRoot() bool {
+	return false
+}
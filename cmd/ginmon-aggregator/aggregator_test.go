@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szuecs/gin-gomonitor/aspects"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+// newTestEndpoint returns a server that exposes the given stats like a
+// monitor endpoint, the keys of stats are the aspect names.
+func newTestEndpoint(stats map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path[1:]
+		res := make(map[string]interface{})
+		if v, ok := stats[name]; ok {
+			res[name] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}))
+}
+
+func newTestStats(offset int) map[string]interface{} {
+	h := ginmon.NewHistogram(ginmon.DefaultRelativeError)
+	for i := 0; i < 100; i++ {
+		h.Add(float64(offset + i))
+	}
+	s := h.Summary()
+	return map[string]interface{}{
+		"Counter": ginmon.CounterAspect{
+			RequestsSum:  100,
+			Requests:     map[string]int{"/": 60, "/foo": 40},
+			RequestCodes: map[int]int{200: 60, 404: 40},
+		},
+		"RequestTime": ginmon.RequestTimeStats{
+			Count:     s.Count,
+			Sum:       s.Sum,
+			Min:       s.Min,
+			Max:       s.Max,
+			Mean:      s.Mean,
+			Stdev:     s.Stdev,
+			P90:       s.P90,
+			P95:       s.P95,
+			P99:       s.P99,
+			Histogram: h,
+		},
+		"generic": ginmon.GenericChannelStats{
+			Metrics: map[string]ginmon.GenericChannelData{
+				"jobs":  {Kind: "counter", Value: 5, Count: 5, Sum: 5},
+				"queue": {Kind: "gauge", Value: float64(offset), Count: 1, Min: 1, Max: float64(offset)},
+			},
+			Dropped: 1,
+		},
+	}
+}
+
+func TestAggregatorScrape(t *testing.T) {
+	var targets []string
+	for _, offset := range []int{0, 100, 200} {
+		srv := newTestEndpoint(newTestStats(offset))
+		defer srv.Close()
+		targets = append(targets, srv.URL)
+	}
+	down := newTestEndpoint(nil)
+	down.Close()
+	targets = append(targets, down.URL)
+
+	agg := newAggregator(&http.Client{Timeout: time.Second}, newTargetList(targets, ""),
+		[]string{"Counter", "RequestTime", "generic", "missing"})
+	agg.scrape()
+
+	counter := (&mergedAspect{a: agg, name: "Counter"}).GetStats().(ginmon.CounterAspect)
+	if assert.Equal(t, 300, counter.RequestsSum, "RequestsSum does not work, expect %d but got %d %s",
+		300, counter.RequestsSum, ballotX) {
+		t.Logf("RequestsSum works, expected %d %s", counter.RequestsSum, checkMark)
+	}
+	if assert.Equal(t, 120, counter.RequestCodes[404], "RequestCodes does not work, expect %d but got %d %s",
+		120, counter.RequestCodes[404], ballotX) {
+		t.Logf("RequestCodes works, expected %d %s", counter.RequestCodes[404], checkMark)
+	}
+
+	rt := (&mergedAspect{a: agg, name: "RequestTime"}).GetStats().(ginmon.RequestTimeStats)
+	if assert.Equal(t, 300, rt.Count, "Count does not work, expect %d but got %d %s",
+		300, rt.Count, ballotX) {
+		t.Logf("Count works, expected %d %s", rt.Count, checkMark)
+	}
+	if assert.Equal(t, 149.5, rt.Mean, "Mean does not work, expect %v but got %v %s",
+		149.5, rt.Mean, ballotX) {
+		t.Logf("Mean works, expected %v %s", rt.Mean, checkMark)
+	}
+	if assert.InEpsilon(t, 86.7, rt.Stdev, 0.01, "Stdev does not work, expect %v but got %v %s",
+		86.7, rt.Stdev, ballotX) {
+		t.Logf("Stdev works, expected %v %s", rt.Stdev, checkMark)
+	}
+	if assert.InEpsilon(t, 297.0, rt.P99, ginmon.DefaultRelativeError, "P99 does not work, expect %v but got %v %s",
+		297.0, rt.P99, ballotX) {
+		t.Logf("P99 works, expected %v %s", rt.P99, checkMark)
+	}
+
+	stats := (&mergedAspect{a: agg, name: "generic"}).GetStats().(ginmon.GenericChannelStats)
+	generic := stats.Metrics
+	if assert.Equal(t, 15.0, generic["jobs"].Value, "Counter value does not work, expect %v but got %v %s",
+		15.0, generic["jobs"].Value, ballotX) {
+		t.Logf("Counter value works, expected %v %s", generic["jobs"].Value, checkMark)
+	}
+	if assert.Equal(t, 200.0, generic["queue"].Max, "Gauge max does not work, expect %v but got %v %s",
+		200.0, generic["queue"].Max, ballotX) {
+		t.Logf("Gauge max works, expected %v %s", generic["queue"].Max, checkMark)
+	}
+	if assert.Equal(t, 3, stats.Dropped, "Dropped does not work, expect %d but got %d %s", 3, stats.Dropped, ballotX) {
+		t.Logf("Dropped works, expected %d %s", stats.Dropped, checkMark)
+	}
+	if assert.Nil(t, (&mergedAspect{a: agg, name: "missing"}).GetStats(), "Missing aspect should be nil %s", ballotX) {
+		t.Logf("Missing aspect is nil %s", checkMark)
+	}
+
+	status := (&targetsAspect{agg}).GetStats().(map[string]targetStatus)
+	for i, target := range targets {
+		expect := i < 3
+		if assert.Equal(t, expect, status[target].Up, "Status of %s does not work, expect %v but got %v %s",
+			target, expect, status[target].Up, ballotX) {
+			t.Logf("Status of %s works, expected %v %s", target, status[target].Up, checkMark)
+		}
+	}
+	if assert.NotEmpty(t, status[down.URL].Error, "Unreachable target should have an error %s", ballotX) {
+		t.Logf("Unreachable target has an error %s", checkMark)
+	}
+}
+
+func TestMergeDistributionsWithoutHistograms(t *testing.T) {
+	d := mergeDistributions([]ginmon.GenericChannelData{
+		{Count: 2, Sum: 2, Mean: 1, Min: 1, Max: 1, P99: 1},
+		{Count: 2, Sum: 6, Mean: 3, Min: 3, Max: 3, P99: 3},
+		{},
+	})
+	if assert.Equal(t, 2.0, d.Mean, "Mean does not work, expect %v but got %v %s",
+		2.0, d.Mean, ballotX) {
+		t.Logf("Mean works, expected %v %s", d.Mean, checkMark)
+	}
+	if assert.Equal(t, 1.0, d.Min, "Min does not work, expect %v but got %v %s",
+		1.0, d.Min, ballotX) {
+		t.Logf("Min works, expected %v %s", d.Min, checkMark)
+	}
+	if assert.Equal(t, 3.0, d.P99, "P99 should be the upper bound, expect %v but got %v %s",
+		3.0, d.P99, ballotX) {
+		t.Logf("P99 is the upper bound %s", checkMark)
+	}
+	if assert.Nil(t, d.Histogram, "Histogram should be nil %s", ballotX) {
+		t.Logf("Histogram is nil %s", checkMark)
+	}
+}
+
+func TestTargetListFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ginmon-aggregator")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "targets")
+
+	write := func(content string, mtime time.Time) {
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+		assert.NoError(t, os.Chtimes(file, mtime, mtime))
+	}
+
+	write("# comment\nhost1:9000\n\nhttp://host2:9000/\n", time.Now().Add(-time.Minute))
+	tl := newTargetList([]string{"static:9000", ""}, file)
+	targets, err := tl.Targets()
+	expect := []string{"http://static:9000", "http://host1:9000", "http://host2:9000"}
+	if assert.NoError(t, err) && assert.Equal(t, expect, targets, "Targets does not work, expect %v but got %v %s",
+		expect, targets, ballotX) {
+		t.Logf("Targets works, expected %v %s", targets, checkMark)
+	}
+
+	write("host3:9000\n", time.Now())
+	targets, err = tl.Targets()
+	expect = []string{"http://static:9000", "http://host3:9000"}
+	if assert.NoError(t, err) && assert.Equal(t, expect, targets, "Reload of targets does not work, expect %v but got %v %s",
+		expect, targets, ballotX) {
+		t.Logf("Reload of targets works, expected %v %s", targets, checkMark)
+	}
+
+	os.Remove(file)
+	targets, err = tl.Targets()
+	if assert.Error(t, err) && assert.Equal(t, expect, targets, "Targets of a removed file should be kept %s", ballotX) {
+		t.Logf("Targets of a removed file are kept %s", checkMark)
+	}
+}
@@ -0,0 +1,42 @@
+// Command ginmon-aggregator scrapes the aspects of many gin-gomonitor
+// endpoints, merges them and exposes the combined view in the same
+// JSON format on its own monitor port. Counters are summed up,
+// distributions are merged exactly if the endpoints expose histograms
+// (see ginmon.Merge). The state of all endpoints is exposed as
+// aspect Targets.
+//
+// Example:
+//    % ginmon-aggregator -targets host1:9000,host2:9000 -aspects Counter,RequestTime,generic
+//    % curl localhost:9100/RequestTime
+//    % curl localhost:9100/Targets
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/szuecs/gin-gomonitor"
+)
+
+func main() {
+	port := flag.Int("port", 9100, "port to expose the merged aspects on")
+	targets := flag.String("targets", "", "comma separated list of monitor endpoints, for example host1:9000,host2:9000")
+	targetsFile := flag.String("targets-file", "", "file with one monitor endpoint per line, reloaded on change")
+	aspectNames := flag.String("aspects", "Counter,RequestTime", "comma separated list of aspects to scrape")
+	interval := flag.Duration("interval", 10*time.Second, "scrape interval")
+	timeout := flag.Duration("timeout", 5*time.Second, "timeout of each request to an endpoint")
+	flag.Parse()
+
+	agg := newAggregator(
+		&http.Client{Timeout: *timeout},
+		newTargetList(strings.Split(*targets, ","), *targetsFile),
+		strings.Split(*aspectNames, ","),
+	)
+	if _, err := gomonitor.StartWithConfig(gomonitor.DefaultConfig(*port), agg.Aspects()); err != nil {
+		log.Fatal(err)
+	}
+	agg.Run(*interval, nil)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// targetList returns the monitor endpoints to scrape. It combines a
+// static list with the endpoints of a file, which is read again if it
+// was changed.
+type targetList struct {
+	sync.Mutex
+	static  []string
+	file    string
+	modTime time.Time
+	cached  []string
+}
+
+func newTargetList(static []string, file string) *targetList {
+	tl := &targetList{file: file}
+	for _, t := range static {
+		if t = strings.TrimSpace(t); t != "" {
+			tl.static = append(tl.static, normalizeTarget(t))
+		}
+	}
+	return tl
+}
+
+// Targets returns all endpoints. If the file can not be read, the
+// endpoints read before are returned together with the error.
+func (tl *targetList) Targets() ([]string, error) {
+	tl.Lock()
+	defer tl.Unlock()
+
+	if tl.file == "" {
+		return tl.static, nil
+	}
+
+	fi, err := os.Stat(tl.file)
+	if err != nil {
+		return tl.all(), err
+	}
+	if !fi.ModTime().Equal(tl.modTime) {
+		targets, err := readTargets(tl.file)
+		if err != nil {
+			return tl.all(), err
+		}
+		tl.cached = targets
+		tl.modTime = fi.ModTime()
+	}
+	return tl.all(), nil
+}
+
+func (tl *targetList) all() []string {
+	targets := make([]string, 0, len(tl.static)+len(tl.cached))
+	targets = append(targets, tl.static...)
+	return append(targets, tl.cached...)
+}
+
+// readTargets reads one endpoint per line, empty lines and lines
+// starting with # are skipped.
+func readTargets(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var targets []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, normalizeTarget(line))
+	}
+	return targets, scanner.Err()
+}
+
+// normalizeTarget adds http:// to endpoints without scheme.
+func normalizeTarget(t string) string {
+	if !strings.Contains(t, "://") {
+		t = "http://" + t
+	}
+	return strings.TrimSuffix(t, "/")
+}
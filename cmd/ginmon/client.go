@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/szuecs/gin-gomonitor"
+)
+
+// client fetches aspects from a monitor endpoint.
+type client struct {
+	base string
+	http *http.Client
+}
+
+func newClient(addr string, c *http.Client) *client {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &client{base: strings.TrimSuffix(addr, "/"), http: c}
+}
+
+// get returns the body of path, which is "" for the root aspects or
+// the name of an aspect.
+func (c *client) get(path string) ([]byte, error) {
+	resp, err := c.http.Get(c.base + "/" + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s/%s returned %s", c.base, path, resp.Status)
+	}
+	return body, nil
+}
+
+// fetch returns the aspects of path by name.
+func (c *client) fetch(path string) (map[string]json.RawMessage, error) {
+	body, err := c.get(path)
+	if err != nil {
+		return nil, err
+	}
+	var res map[string]json.RawMessage
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode %s/%s: %v", c.base, path, err)
+	}
+	return res, nil
+}
+
+// aspectNames returns the names of all aspects listed by the index of
+// the endpoint.
+func (c *client) aspectNames() ([]string, error) {
+	res, err := c.fetch(gomonitor.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := res[gomonitor.IndexName]
+	if !ok {
+		return nil, fmt.Errorf("%s does not list its aspects, please pass aspect names", c.base)
+	}
+	var names []string
+	err = json.Unmarshal(raw, &names)
+	return names, err
+}
+
+// fetchAll returns the root aspects and all aspects listed by the
+// index, or only the given aspects if names is not empty.
+func (c *client) fetchAll(names []string) (map[string]json.RawMessage, error) {
+	if len(names) == 0 {
+		root, err := c.fetch("")
+		if err != nil {
+			return nil, err
+		}
+		names, err = c.aspectNames()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			res, err := c.fetch(name)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range res {
+				root[k] = v
+			}
+		}
+		return root, nil
+	}
+
+	all := make(map[string]json.RawMessage, len(names))
+	for _, name := range names {
+		res, err := c.fetch(name)
+		if err != nil {
+			return nil, err
+		}
+		raw, ok := res[name]
+		if !ok {
+			return nil, fmt.Errorf("aspect %s not found", name)
+		}
+		all[name] = raw
+	}
+	return all, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szuecs/gin-gomonitor/aspects"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+// newTestEndpoint returns a server that exposes the given stats like a
+// monitor endpoint, root are the stats exposed at /.
+func newTestEndpoint(root, stats map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path[1:]
+		res := make(map[string]interface{})
+		if name == "" {
+			res = root
+		} else if v, ok := stats[name]; ok {
+			res[name] = v
+		} else if v, ok := root[name]; ok {
+			res[name] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}))
+}
+
+func newTestServer() *httptest.Server {
+	return newTestEndpoint(
+		map[string]interface{}{"Runtime": map[string]interface{}{"GoroutineNum": 7}},
+		map[string]interface{}{
+			"Aspects": []string{"Counter", "RequestTime"},
+			"Counter": ginmon.CounterAspect{
+				RequestsSum:  30,
+				Requests:     map[string]int{"/": 10, "/foo": 20},
+				RequestCodes: map[int]int{200: 30},
+			},
+			"RequestTime": ginmon.RequestTimeStats{Count: 30, P99: 2500000},
+		},
+	)
+}
+
+func TestClientFetchAll(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	c := newClient(strings.TrimPrefix(srv.URL, "http://"), &http.Client{Timeout: time.Second})
+
+	all, err := c.fetchAll(nil)
+	if assert.NoError(t, err) && assert.Len(t, all, 3, "fetchAll should fetch root and indexed aspects %s", ballotX) {
+		t.Logf("fetchAll fetches root and indexed aspects %s", checkMark)
+	}
+
+	all, err = c.fetchAll([]string{"Counter"})
+	if assert.NoError(t, err) && assert.Len(t, all, 1, "fetchAll should fetch the given aspects %s", ballotX) {
+		t.Logf("fetchAll fetches the given aspects %s", checkMark)
+	}
+
+	_, err = c.fetchAll([]string{"missing"})
+	if assert.Error(t, err, "fetchAll of a missing aspect should fail %s", ballotX) {
+		t.Logf("fetchAll of a missing aspect fails %s", checkMark)
+	}
+}
+
+func TestList(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	c := newClient(srv.URL, &http.Client{Timeout: time.Second})
+
+	var buf bytes.Buffer
+	expect := "Runtime (root)\nCounter\nRequestTime\n"
+	if assert.NoError(t, list(&buf, c, false)) && assert.Equal(t, expect, buf.String(),
+		"list does not work, expect %s but got %s %s", expect, buf.String(), ballotX) {
+		t.Logf("list works %s", checkMark)
+	}
+}
+
+func TestGetJSON(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	c := newClient(srv.URL, &http.Client{Timeout: time.Second})
+
+	var buf bytes.Buffer
+	err := get(&buf, c, []string{"RequestTime"}, options{json: true})
+	var res map[string]ginmon.RequestTimeStats
+	if assert.NoError(t, err) && assert.NoError(t, json.Unmarshal(buf.Bytes(), &res)) &&
+		assert.Equal(t, 30, res["RequestTime"].Count, "--json should pass through the JSON %s", ballotX) {
+		t.Logf("--json passes through the JSON %s", checkMark)
+	}
+}
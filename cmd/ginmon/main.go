@@ -0,0 +1,156 @@
+// Command ginmon queries a gin-gomonitor endpoint and prints its
+// aspects as tables. Request times are converted from nanoseconds to
+// milliseconds, routes and status codes are sorted by count.
+//
+// Usage:
+//    ginmon [flags] list             list the aspects of the endpoint
+//    ginmon [flags] get [aspect...]  print the given or all aspects
+//    ginmon [flags] top              show a live view, q quits
+//
+// Example:
+//    % ginmon -addr localhost:9000 list
+//    % ginmon get Counter RequestTime
+//    % ginmon --watch --interval 5s get Counter
+//    % ginmon --json get RequestTime | jq .RequestTime.p99
+//    % ginmon --interval 1s top
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/szuecs/gin-gomonitor"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9000", "address of the monitor endpoint")
+	jsonOut := flag.Bool("json", false, "print the JSON of the endpoint as received")
+	watch := flag.Bool("watch", false, "poll the endpoint and show deltas to the previous poll")
+	interval := flag.Duration("interval", 2*time.Second, "poll interval of --watch and top")
+	timeout := flag.Duration("timeout", 5*time.Second, "timeout of each request")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] list|get [aspect...]|top\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cmd, args := "get", flag.Args()
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	c := newClient(*addr, &http.Client{Timeout: *timeout})
+	var err error
+	switch cmd {
+	case "list":
+		err = list(os.Stdout, c, *jsonOut)
+	case "get":
+		o := options{json: *jsonOut, watch: *watch, interval: *interval}
+		err = get(os.Stdout, c, args, o)
+	case "top":
+		err = top(os.Stdout, c, *interval)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// options of the get command.
+type options struct {
+	json     bool
+	watch    bool
+	interval time.Duration
+}
+
+// list prints the names of all aspects of the endpoint.
+func list(w io.Writer, c *client, jsonOut bool) error {
+	if jsonOut {
+		body, err := c.get(gomonitor.IndexName)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(body)
+		return err
+	}
+
+	names, err := c.aspectNames()
+	if err != nil {
+		return err
+	}
+	root, err := c.fetch("")
+	if err != nil {
+		return err
+	}
+	rootNames := make([]string, 0, len(root))
+	for name := range root {
+		rootNames = append(rootNames, name)
+	}
+	sort.Strings(rootNames)
+	for _, name := range rootNames {
+		fmt.Fprintf(w, "%s (root)\n", name)
+	}
+	for _, name := range names {
+		fmt.Fprintln(w, name)
+	}
+	return nil
+}
+
+// get prints the given aspects or all aspects of the endpoint. With
+// watch it polls the endpoint until an error occurs.
+func get(w io.Writer, c *client, names []string, o options) error {
+	if o.json {
+		return getJSON(w, c, names, o)
+	}
+
+	var prev map[string]json.RawMessage
+	for {
+		all, err := c.fetchAll(names)
+		if err != nil {
+			return err
+		}
+		if o.watch {
+			fmt.Fprintf(w, "--- %s ---\n", time.Now().Format(time.RFC3339))
+		}
+		if err := renderAll(w, all, prev); err != nil {
+			return err
+		}
+		if !o.watch {
+			return nil
+		}
+		prev = all
+		time.Sleep(o.interval)
+	}
+}
+
+// getJSON prints the bodies of the endpoint as received, one per line.
+func getJSON(w io.Writer, c *client, names []string, o options) error {
+	paths := names
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	for {
+		for _, path := range paths {
+			body, err := c.get(path)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%s\n", body); err != nil {
+				return err
+			}
+		}
+		if !o.watch {
+			return nil
+		}
+		time.Sleep(o.interval)
+	}
+}
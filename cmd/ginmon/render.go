@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/szuecs/gin-gomonitor/aspects"
+)
+
+// aspectType is the type of an aspect detected by its JSON keys.
+type aspectType int
+
+const (
+	otherType aspectType = iota
+	counterType
+	requestTimeType
+	genericType
+	phaseType
+)
+
+// detect returns the type of the aspect JSON raw.
+func detect(raw json.RawMessage) aspectType {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return otherType
+	}
+	if _, ok := keys["request_sum_per_minute"]; ok {
+		return counterType
+	}
+	if _, ok := keys["p99"]; ok {
+		return requestTimeType
+	}
+	if _, ok := keys["routes"]; ok {
+		return phaseType
+	}
+	if _, ok := keys["metrics"]; ok {
+		if _, ok := keys["dropped"]; ok {
+			return genericType
+		}
+	}
+	return otherType
+}
+
+// renderAll renders all aspects sorted by name, prev are the aspects of
+// the previous poll or nil.
+func renderAll(w io.Writer, all, prev map[string]json.RawMessage) error {
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := render(w, name, all[name], prev[name]); err != nil {
+			return fmt.Errorf("failed to render %s: %v", name, err)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// render writes the aspect raw as table to w. If prev is not nil, the
+// deltas to prev are shown.
+func render(w io.Writer, name string, raw, prev json.RawMessage) error {
+	fmt.Fprintf(w, "%s\n", name)
+	switch detect(raw) {
+	case counterType:
+		var cur ginmon.CounterAspect
+		var old *ginmon.CounterAspect
+		if err := decode(raw, prev, &cur, &old); err != nil {
+			return err
+		}
+		renderCounter(w, &cur, old)
+	case requestTimeType:
+		var cur ginmon.RequestTimeStats
+		var old *ginmon.RequestTimeStats
+		if err := decode(raw, prev, &cur, &old); err != nil {
+			return err
+		}
+		renderRequestTime(w, &cur, old)
+	case genericType:
+		var cur ginmon.GenericChannelStats
+		var old *ginmon.GenericChannelStats
+		if err := decode(raw, prev, &cur, &old); err != nil {
+			return err
+		}
+		renderGeneric(w, &cur, old)
+	default:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, raw, "  ", "  "); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "  %s\n", buf.String())
+	}
+	return nil
+}
+
+// decode unmarshals raw into cur and prev into old, old is not
+// touched if prev is nil.
+func decode(raw, prev json.RawMessage, cur, old interface{}) error {
+	if err := json.Unmarshal(raw, cur); err != nil {
+		return err
+	}
+	if prev == nil {
+		return nil
+	}
+	return json.Unmarshal(prev, old)
+}
+
+func newTable(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+}
+
+// delta returns the difference to the previous poll, or "" if there is
+// no previous poll.
+func delta(cur, prev float64, hasPrev bool) string {
+	if !hasPrev {
+		return ""
+	}
+	return strconv.FormatFloat(cur-prev, 'f', -1, 64)
+}
+
+func signed(s string) string {
+	if s == "" || s[0] == '-' {
+		return s
+	}
+	return "+" + s
+}
+
+// ms converts nanoseconds to milliseconds.
+func ms(ns float64) string {
+	return strconv.FormatFloat(ns/1e6, 'f', 3, 64)
+}
+
+// renderCounter shows the sum of requests, and requests by route and
+// code sorted by count.
+func renderCounter(w io.Writer, cur, prev *ginmon.CounterAspect) {
+	hasPrev := prev != nil
+	if !hasPrev {
+		prev = &ginmon.CounterAspect{}
+	}
+
+	tw := newTable(w)
+	fmt.Fprintf(tw, "  REQUESTS\tDELTA\n")
+	fmt.Fprintf(tw, "  %d\t%s\n", cur.RequestsSum,
+		signed(delta(float64(cur.RequestsSum), float64(prev.RequestsSum), hasPrev)))
+	tw.Flush()
+
+	paths := make([]string, 0, len(cur.Requests))
+	for path := range cur.Requests {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if cur.Requests[paths[i]] == cur.Requests[paths[j]] {
+			return paths[i] < paths[j]
+		}
+		return cur.Requests[paths[i]] > cur.Requests[paths[j]]
+	})
+	tw = newTable(w)
+	fmt.Fprintf(tw, "  ROUTE\tCOUNT\tDELTA\n")
+	for _, path := range paths {
+		fmt.Fprintf(tw, "  %s\t%d\t%s\n", path, cur.Requests[path],
+			signed(delta(float64(cur.Requests[path]), float64(prev.Requests[path]), hasPrev)))
+	}
+	tw.Flush()
+
+	codes := make([]int, 0, len(cur.RequestCodes))
+	for code := range cur.RequestCodes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if cur.RequestCodes[codes[i]] == cur.RequestCodes[codes[j]] {
+			return codes[i] < codes[j]
+		}
+		return cur.RequestCodes[codes[i]] > cur.RequestCodes[codes[j]]
+	})
+	tw = newTable(w)
+	fmt.Fprintf(tw, "  CODE\tCOUNT\tDELTA\n")
+	for _, code := range codes {
+		fmt.Fprintf(tw, "  %d\t%d\t%s\n", code, cur.RequestCodes[code],
+			signed(delta(float64(cur.RequestCodes[code]), float64(prev.RequestCodes[code]), hasPrev)))
+	}
+	tw.Flush()
+}
+
+// renderRequestTime shows the request time statistics in
+// milliseconds.
+func renderRequestTime(w io.Writer, cur, prev *ginmon.RequestTimeStats) {
+	hasPrev := prev != nil
+	if !hasPrev {
+		prev = &ginmon.RequestTimeStats{}
+	}
+
+	tw := newTable(w)
+	fmt.Fprintf(tw, "  COUNT\tDELTA\tRATE/S\tMIN(ms)\tMEAN(ms)\tP90(ms)\tP95(ms)\tP99(ms)\tMAX(ms)\tP99 DELTA(ms)\n")
+	p99Delta := ""
+	if hasPrev {
+		p99Delta = signed(ms(cur.P99 - prev.P99))
+	}
+	fmt.Fprintf(tw, "  %d\t%s\t%.2f\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		cur.Count, signed(delta(float64(cur.Count), float64(prev.Count), hasPrev)), cur.RatePerSecond,
+		ms(cur.Min), ms(cur.Mean), ms(cur.P90), ms(cur.P95), ms(cur.P99), ms(cur.Max), p99Delta)
+	tw.Flush()
+}
+
+// renderGeneric shows all names of a GenericChannelAspect sorted by
+// name and the dropped values and removed names. Values are shown as
+// sent, without unit conversion.
+func renderGeneric(w io.Writer, cur, prev *ginmon.GenericChannelStats) {
+	if prev == nil {
+		prev = &ginmon.GenericChannelStats{}
+	}
+	names := make([]string, 0, len(cur.Metrics))
+	for name := range cur.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := newTable(w)
+	fmt.Fprintf(tw, "  NAME\tKIND\tCOUNT\tVALUE\tDELTA\tMIN\tMEAN\tP99\tMAX\n")
+	for _, name := range names {
+		d := cur.Metrics[name]
+		old, hasPrev := prev.Metrics[name]
+		value := d.Value
+		if d.Kind == ginmon.KindDistribution.String() || d.Kind == "" {
+			value = d.Mean
+			old.Value = old.Mean
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%d\t%g\t%s\t%g\t%g\t%g\t%g\n",
+			name, d.Kind, d.Count, value, signed(delta(value, old.Value, hasPrev)),
+			d.Min, d.Mean, d.P99, d.Max)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "  dropped %d, expired %d, evicted %d\n", cur.Dropped, cur.Expired, cur.Evicted)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szuecs/gin-gomonitor/aspects"
+)
+
+func mustMarshal(v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestDetect(t *testing.T) {
+	for expect, v := range map[aspectType]interface{}{
+		counterType:     ginmon.CounterAspect{},
+		requestTimeType: ginmon.RequestTimeStats{},
+		genericType:     ginmon.GenericChannelStats{Metrics: map[string]ginmon.GenericChannelData{"foo": {}}},
+		phaseType:       ginmon.PhaseStats{},
+		otherType:       map[string]int{"GoroutineNum": 7},
+	} {
+		got := detect(mustMarshal(v))
+		if assert.Equal(t, expect, got, "detect does not work, expect %v but got %v %s", expect, got, ballotX) {
+			t.Logf("detect works, expected %v %s", got, checkMark)
+		}
+	}
+}
+
+func TestRenderCounter(t *testing.T) {
+	prev := mustMarshal(ginmon.CounterAspect{
+		RequestsSum: 10,
+		Requests:    map[string]int{"/": 5, "/foo": 5},
+	})
+	cur := mustMarshal(ginmon.CounterAspect{
+		RequestsSum:  30,
+		Requests:     map[string]int{"/": 10, "/foo": 20},
+		RequestCodes: map[int]int{200: 30},
+	})
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, render(&buf, "Counter", cur, prev)) {
+		return
+	}
+	out := buf.String()
+	if assert.True(t, strings.Index(out, "/foo") < strings.Index(out, "/ "),
+		"Routes should be sorted by count %s\n%s", ballotX, out) {
+		t.Logf("Routes are sorted by count %s", checkMark)
+	}
+	if assert.Contains(t, out, "+15", "Delta should be shown %s", ballotX) {
+		t.Logf("Delta is shown %s", checkMark)
+	}
+}
+
+func TestRenderRequestTime(t *testing.T) {
+	cur := mustMarshal(ginmon.RequestTimeStats{Count: 3, P99: 2500000})
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, render(&buf, "RequestTime", cur, nil)) {
+		return
+	}
+	if assert.Contains(t, buf.String(), "2.500", "P99 should be converted to ms %s", ballotX) {
+		t.Logf("P99 is converted to ms %s", checkMark)
+	}
+}
+
+func TestRenderGeneric(t *testing.T) {
+	cur := mustMarshal(ginmon.GenericChannelStats{
+		Metrics: map[string]ginmon.GenericChannelData{
+			"b": {Kind: "counter", Value: 7, Count: 7},
+			"a": {Kind: "distribution", Mean: 1.5, Count: 2},
+		},
+		Dropped: 3,
+	})
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, render(&buf, "generic", cur, nil)) {
+		return
+	}
+	out := buf.String()
+	if assert.True(t, strings.Index(out, "  a ") < strings.Index(out, "  b "),
+		"Names should be sorted %s\n%s", ballotX, out) {
+		t.Logf("Names are sorted %s", checkMark)
+	}
+	if assert.Contains(t, out, "dropped 3", "Dropped values should be shown %s", ballotX) {
+		t.Logf("Dropped values are shown %s", checkMark)
+	}
+}
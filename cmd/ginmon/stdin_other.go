@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// openInput returns stdin, a pending Read is not stopped by Close.
+func openInput(fd int) (io.ReadCloser, error) {
+	return io.NopCloser(os.Stdin), nil
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// openInput returns a reader of the terminal fd, that can be closed to
+// stop a pending Read. The fd is duplicated and switched to
+// non-blocking mode, such that reads use the runtime poller.
+func openInput(fd int) (io.ReadCloser, error) {
+	dup, err := syscall.Dup(fd)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.SetNonblock(dup, true); err != nil {
+		syscall.Close(dup)
+		return nil, err
+	}
+	return &input{File: os.NewFile(uintptr(dup), "stdin"), fd: fd}, nil
+}
+
+// input restores blocking mode of the terminal on Close, the flag is
+// shared by all duplicates of the fd.
+type input struct {
+	*os.File
+	fd int
+}
+
+func (in *input) Close() error {
+	err := in.File.Close()
+	syscall.SetNonblock(in.fd, false)
+	return err
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/szuecs/gin-gomonitor/aspects"
+	"golang.org/x/term"
+)
+
+// key is a keyboard command of the top view.
+type key int
+
+const (
+	keyNone key = iota
+	keyQuit
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyLeft
+	keyRight
+	keyNextTable
+	keyReverse
+	keyRefresh
+)
+
+// parseKeys translates the bytes read from a terminal in raw mode into
+// keys, unknown bytes are skipped.
+func parseKeys(b []byte) []key {
+	var keys []key
+	for i := 0; i < len(b); i++ {
+		switch b[i] {
+		case 'q', 3: // ctrl-c
+			keys = append(keys, keyQuit)
+		case 'k':
+			keys = append(keys, keyUp)
+		case 'j':
+			keys = append(keys, keyDown)
+		case 'h', '<':
+			keys = append(keys, keyLeft)
+		case 'l', '>':
+			keys = append(keys, keyRight)
+		case '\t':
+			keys = append(keys, keyNextTable)
+		case 'r':
+			keys = append(keys, keyReverse)
+		case ' ':
+			keys = append(keys, keyRefresh)
+		case 0x1b:
+			if i+2 >= len(b) || b[i+1] != '[' {
+				continue
+			}
+			switch b[i+2] {
+			case 'A':
+				keys = append(keys, keyUp)
+			case 'B':
+				keys = append(keys, keyDown)
+			case 'C':
+				keys = append(keys, keyRight)
+			case 'D':
+				keys = append(keys, keyLeft)
+			case '5', '6':
+				if i+3 < len(b) && b[i+3] == '~' {
+					if b[i+2] == '5' {
+						keys = append(keys, keyPageUp)
+					} else {
+						keys = append(keys, keyPageDown)
+					}
+					i++
+				}
+			}
+			i += 2
+		}
+	}
+	return keys
+}
+
+// snapshot is the data of one poll of the endpoint.
+type snapshot struct {
+	time        time.Time
+	err         error
+	counter     *ginmon.CounterAspect
+	requestTime *ginmon.RequestTimeStats
+	generic     map[string]map[string]ginmon.GenericChannelData
+	phases      map[string]ginmon.PhaseStats
+	memStats    struct {
+		HeapAlloc uint64
+		Sys       uint64
+		NumGC     uint32
+	}
+	runtime struct {
+		GoroutineNum int
+	}
+}
+
+// newSnapshot decodes all aspects by their type, the first counter and
+// request time aspect by name are used.
+func newSnapshot(all map[string]json.RawMessage, err error) *snapshot {
+	s := &snapshot{
+		time:    time.Now(),
+		err:     err,
+		generic: make(map[string]map[string]ginmon.GenericChannelData),
+		phases:  make(map[string]ginmon.PhaseStats),
+	}
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		raw := all[name]
+		switch {
+		case name == "MemStats":
+			json.Unmarshal(raw, &s.memStats)
+		case name == "Runtime":
+			json.Unmarshal(raw, &s.runtime)
+		default:
+			switch detect(raw) {
+			case counterType:
+				if s.counter == nil {
+					s.counter = &ginmon.CounterAspect{}
+					json.Unmarshal(raw, s.counter)
+				}
+			case requestTimeType:
+				if s.requestTime == nil {
+					s.requestTime = &ginmon.RequestTimeStats{}
+					json.Unmarshal(raw, s.requestTime)
+				}
+			case genericType:
+				var g ginmon.GenericChannelStats
+				if json.Unmarshal(raw, &g) == nil {
+					s.generic[name] = g.Metrics
+				}
+			case phaseType:
+				var p ginmon.PhaseStats
+				if json.Unmarshal(raw, &p) == nil {
+					s.phases[name] = p
+				}
+			}
+		}
+	}
+	return s
+}
+
+// cell is one value of a table, numeric cells are sorted by value.
+type cell struct {
+	text    string
+	value   float64
+	numeric bool
+}
+
+func textCell(s string) cell {
+	return cell{text: s}
+}
+
+func numCell(v float64, text string) cell {
+	return cell{text: text, value: v, numeric: true}
+}
+
+// table is a sortable list of rows with a selected row. empty is
+// shown instead of the rows, if there are none.
+type table struct {
+	title    string
+	empty    string
+	columns  []string
+	rows     [][]cell
+	sortCol  int
+	desc     bool
+	selected int
+	offset   int
+}
+
+func (t *table) sortRows() {
+	sort.SliceStable(t.rows, func(i, j int) bool {
+		a, b := t.rows[i][t.sortCol], t.rows[j][t.sortCol]
+		if t.desc {
+			a, b = b, a
+		}
+		if a.numeric && a.value != b.value {
+			return a.value < b.value
+		}
+		if !a.numeric && a.text != b.text {
+			return a.text < b.text
+		}
+		// rows come from maps, keep equal rows in a stable order
+		return rowKey(t.rows[i]) < rowKey(t.rows[j])
+	})
+}
+
+func rowKey(row []cell) string {
+	texts := make([]string, len(row))
+	for i, c := range row {
+		texts[i] = c.text
+	}
+	return strings.Join(texts, "\x00")
+}
+
+// setRows replaces the rows and keeps sort order and selection.
+func (t *table) setRows(rows [][]cell) {
+	t.rows = rows
+	t.sortRows()
+	t.move(0)
+}
+
+// move changes the selected row by n and keeps it in range.
+func (t *table) move(n int) {
+	t.selected += n
+	if t.selected >= len(t.rows) {
+		t.selected = len(t.rows) - 1
+	}
+	if t.selected < 0 {
+		t.selected = 0
+	}
+}
+
+// topModel is the state of the top view.
+type topModel struct {
+	addr    string
+	current *snapshot
+	tables  []*table
+	focus   int
+}
+
+func newTopModel(addr string) *topModel {
+	return &topModel{
+		addr: addr,
+		tables: []*table{
+			{title: "Routes", columns: []string{"ROUTE", "COUNT", "SHARE%"}, sortCol: 1, desc: true},
+			{title: "Status codes", columns: []string{"CODE", "COUNT", "SHARE%"}, sortCol: 1, desc: true},
+			{title: "Generic", columns: []string{"ASPECT", "NAME", "KIND", "COUNT", "RATE/S", "VALUE", "MEAN", "P99", "MAX"}, sortCol: 7, desc: true},
+			{title: "Route p99", columns: []string{"ASPECT", "ROUTE", "COUNT", "RATE/S", "MEAN MS", "P99 MS", "MAX MS"}, sortCol: 5, desc: true,
+				empty: "no per-route latency data, serve a PhaseAspect with PhaseHandler"},
+		},
+	}
+}
+
+// update sets the data of a new poll, on errors the data of the last
+// successful poll is kept.
+func (m *topModel) update(s *snapshot) {
+	if s.err != nil && m.current != nil {
+		m.current.err = s.err
+		return
+	}
+	m.current = s
+
+	var routes, codes [][]cell
+	if s.counter != nil {
+		total := float64(s.counter.RequestsSum)
+		for path, n := range s.counter.Requests {
+			routes = append(routes, []cell{textCell(path), numCell(float64(n), strconv.Itoa(n)), share(float64(n), total)})
+		}
+		for code, n := range s.counter.RequestCodes {
+			codes = append(codes, []cell{numCell(float64(code), strconv.Itoa(code)), numCell(float64(n), strconv.Itoa(n)), share(float64(n), total)})
+		}
+	}
+	m.tables[0].setRows(routes)
+	m.tables[1].setRows(codes)
+
+	var generic [][]cell
+	for aspect, g := range s.generic {
+		for name, d := range g {
+			generic = append(generic, []cell{
+				textCell(aspect), textCell(name), textCell(d.Kind),
+				numCell(float64(d.Count), strconv.Itoa(d.Count)),
+				numCell(d.RatePerSecond, fmt.Sprintf("%.2f", d.RatePerSecond)),
+				numCell(d.Value, fmt.Sprintf("%g", d.Value)),
+				numCell(d.Mean, fmt.Sprintf("%g", d.Mean)),
+				numCell(d.P99, fmt.Sprintf("%g", d.P99)),
+				numCell(d.Max, fmt.Sprintf("%g", d.Max)),
+			})
+		}
+	}
+	m.tables[2].setRows(generic)
+
+	// the total phase of a PhaseAspect is the latency of the route
+	var routeLatencies [][]cell
+	for aspect, p := range s.phases {
+		for route, phases := range p.Routes {
+			d, ok := phases[ginmon.TotalPhase]
+			if !ok {
+				continue
+			}
+			routeLatencies = append(routeLatencies, []cell{
+				textCell(aspect), textCell(route),
+				numCell(float64(d.Count), strconv.Itoa(d.Count)),
+				numCell(d.RatePerSecond, fmt.Sprintf("%.2f", d.RatePerSecond)),
+				numCell(d.Mean, ms(d.Mean)),
+				numCell(d.P99, ms(d.P99)),
+				numCell(d.Max, ms(d.Max)),
+			})
+		}
+	}
+	m.tables[3].setRows(routeLatencies)
+}
+
+func share(n, total float64) cell {
+	if total == 0 {
+		return numCell(0, "0.0")
+	}
+	return numCell(n/total*100, fmt.Sprintf("%.1f", n/total*100))
+}
+
+// handle changes the state by k, it returns false if the view should
+// be closed.
+func (m *topModel) handle(k key) bool {
+	t := m.tables[m.focus]
+	switch k {
+	case keyQuit:
+		return false
+	case keyUp:
+		t.move(-1)
+	case keyDown:
+		t.move(1)
+	case keyPageUp:
+		t.move(-10)
+	case keyPageDown:
+		t.move(10)
+	case keyLeft:
+		t.sortCol = (t.sortCol + len(t.columns) - 1) % len(t.columns)
+		t.sortRows()
+	case keyRight:
+		t.sortCol = (t.sortCol + 1) % len(t.columns)
+		t.sortRows()
+	case keyReverse:
+		t.desc = !t.desc
+		t.sortRows()
+	case keyNextTable:
+		m.focus = (m.focus + 1) % len(m.tables)
+	}
+	return true
+}
+
+// view renders the state for a terminal of the given size, lines are
+// separated by \r\n as needed in raw mode.
+func (m *topModel) view(width, height int) string {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	add("ginmon top - %s - q quit, tab next table, left/right sort column, r reverse, up/down select", m.addr)
+	s := m.current
+	if s == nil {
+		add("waiting for data")
+		return strings.Join(truncate(lines, width, height), "\r\n")
+	}
+	if s.err != nil {
+		add("\x1b[1merror: %v\x1b[0m", s.err)
+	} else {
+		add("updated %s", s.time.Format("15:04:05"))
+	}
+	if rt := s.requestTime; rt != nil {
+		add("requests %.2f/s  count %d  mean %sms  p90 %sms  p95 %sms  p99 %sms  max %sms",
+			rt.RatePerSecond, rt.Count, ms(rt.Mean), ms(rt.P90), ms(rt.P95), ms(rt.P99), ms(rt.Max))
+	}
+	if c := s.counter; c != nil {
+		classes := make([]float64, 6)
+		for code, n := range c.RequestCodes {
+			if code/100 < len(classes) {
+				classes[code/100] += float64(n)
+			}
+		}
+		total := float64(c.RequestsSum)
+		add("status 2xx %s%%  3xx %s%%  4xx %s%%  5xx %s%%",
+			share(classes[2], total).text, share(classes[3], total).text,
+			share(classes[4], total).text, share(classes[5], total).text)
+	}
+	add("goroutines %d  heap %.1fMB  sys %.1fMB  gc %d",
+		s.runtime.GoroutineNum, float64(s.memStats.HeapAlloc)/1e6, float64(s.memStats.Sys)/1e6, s.memStats.NumGC)
+
+	// split the remaining lines between the tables, each table needs
+	// a blank line, a title and a header
+	rowsPerTable := (height - len(lines) - 3*len(m.tables)) / len(m.tables)
+	if rowsPerTable < 1 {
+		rowsPerTable = 1
+	}
+	for i, t := range m.tables {
+		lines = append(lines, "")
+		lines = append(lines, m.renderTable(t, i == m.focus, rowsPerTable)...)
+	}
+	return strings.Join(truncate(lines, width, height), "\r\n")
+}
+
+// renderTable returns the title, header and at most n visible rows of
+// t, scrolled such that the selected row is visible.
+func (m *topModel) renderTable(t *table, focused bool, n int) []string {
+	if t.selected < t.offset {
+		t.offset = t.selected
+	}
+	if t.selected >= t.offset+n {
+		t.offset = t.selected - n + 1
+	}
+
+	widths := make([]int, len(t.columns))
+	for i, c := range t.columns {
+		widths[i] = len(c) + 2
+	}
+	for _, row := range t.rows {
+		for i, c := range row {
+			if len(c.text) > widths[i] {
+				widths[i] = len(c.text)
+			}
+		}
+	}
+
+	order := "asc"
+	if t.desc {
+		order = "desc"
+	}
+	title := fmt.Sprintf("%s (%d, sorted by %s %s)", t.title, len(t.rows), t.columns[t.sortCol], order)
+	if focused {
+		title = "\x1b[1m> " + title + "\x1b[0m"
+	} else {
+		title = "  " + title
+	}
+	lines := []string{title}
+
+	header := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		if i == t.sortCol {
+			c = "[" + c + "]"
+		}
+		header[i] = pad(c, widths[i], i > 0)
+	}
+	lines = append(lines, "  \x1b[7m"+strings.Join(header, "  ")+"\x1b[0m")
+	if len(t.rows) == 0 && t.empty != "" {
+		return append(lines, "  "+t.empty)
+	}
+
+	for i := t.offset; i < len(t.rows) && i < t.offset+n; i++ {
+		cols := make([]string, len(t.rows[i]))
+		for j, c := range t.rows[i] {
+			cols[j] = pad(c.text, widths[j], c.numeric)
+		}
+		line := strings.Join(cols, "  ")
+		if focused && i == t.selected {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		lines = append(lines, "  "+line)
+	}
+	return lines
+}
+
+func pad(s string, width int, right bool) string {
+	if right {
+		return fmt.Sprintf("%*s", width, s)
+	}
+	return fmt.Sprintf("%-*s", width, s)
+}
+
+// truncate limits lines to the size of the terminal. Lines with escape
+// sequences are not cut, because their visible length is unknown.
+func truncate(lines []string, width, height int) []string {
+	if height > 0 && len(lines) > height {
+		lines = lines[:height]
+	}
+	for i, l := range lines {
+		if width > 0 && len(l) > width && !strings.Contains(l, "\x1b") {
+			lines[i] = l[:width]
+		}
+	}
+	return lines
+}
+
+// readKeys sends the keys read from r to keys until reading fails or
+// done is closed, keys is closed on return.
+func readKeys(r io.Reader, keys chan<- key, done <-chan struct{}) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, k := range parseKeys(buf[:n]) {
+			select {
+			case keys <- k:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// top shows a continuously refreshing view of the endpoint until q is
+// pressed. It needs a terminal on stdin.
+func top(w io.Writer, c *client, interval time.Duration) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("top needs a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	io.WriteString(w, "\x1b[?25l") // hide cursor
+	defer io.WriteString(w, "\x1b[?25h\x1b[H\x1b[2J")
+
+	in, err := openInput(fd)
+	if err != nil {
+		return err
+	}
+	keys, done := make(chan key), make(chan struct{})
+	defer in.Close()
+	defer close(done)
+	go readKeys(in, keys, done)
+
+	m := newTopModel(c.base)
+	refresh := func() {
+		m.update(newSnapshot(c.fetchAll(nil)))
+	}
+	draw := func() {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		io.WriteString(w, "\x1b[H\x1b[2J"+m.view(width, height))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	refresh()
+	draw()
+	for {
+		select {
+		case <-ticker.C:
+			refresh()
+		case k, ok := <-keys:
+			if !ok || !m.handle(k) {
+				return nil
+			}
+			if k == keyRefresh {
+				refresh()
+			}
+		}
+		draw()
+	}
+}
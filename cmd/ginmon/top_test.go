@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szuecs/gin-gomonitor/aspects"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("jk\x1b[A\x1b[B\x1b[C\x1b[D\x1b[5~\x1b[6~\tr q\x03x"))
+	expect := []key{keyDown, keyUp, keyUp, keyDown, keyRight, keyLeft, keyPageUp, keyPageDown,
+		keyNextTable, keyReverse, keyRefresh, keyQuit, keyQuit}
+	if assert.Equal(t, expect, keys, "parseKeys does not work, expect %v but got %v %s", expect, keys, ballotX) {
+		t.Logf("parseKeys works %s", checkMark)
+	}
+}
+
+func TestReadKeys(t *testing.T) {
+	keys, done := make(chan key), make(chan struct{})
+	go readKeys(strings.NewReader("jjj"), keys, done)
+	<-keys
+	close(done)
+	for range keys {
+	}
+	t.Logf("readKeys stops when done is closed %s", checkMark)
+}
+
+func newTestSnapshot() *snapshot {
+	return newSnapshot(map[string]json.RawMessage{
+		"Counter": mustMarshal(ginmon.CounterAspect{
+			RequestsSum:  100,
+			Requests:     map[string]int{"/a": 10, "/b": 60, "/c": 30},
+			RequestCodes: map[int]int{200: 90, 500: 10},
+		}),
+		"RequestTime": mustMarshal(ginmon.RequestTimeStats{Count: 100, RatePerSecond: 20, P99: 1500000}),
+		"generic": mustMarshal(ginmon.GenericChannelStats{Metrics: map[string]ginmon.GenericChannelData{
+			"fast": {Kind: "distribution", Count: 1, P99: 1},
+			"slow": {Kind: "distribution", Count: 1, P99: 9},
+		}}),
+		"Phases": mustMarshal(ginmon.PhaseStats{Routes: map[string]map[string]ginmon.GenericChannelData{
+			"/items/:id": {ginmon.TotalPhase: {Count: 3, P99: 7e6}, "db": {Count: 3, P99: 20e6}},
+			"/items":     {ginmon.TotalPhase: {Count: 5, P99: 12e6}},
+		}}),
+		"Runtime": mustMarshal(map[string]int{"GoroutineNum": 42}),
+	}, nil)
+}
+
+func TestTopModelSort(t *testing.T) {
+	m := newTopModel("localhost:9000")
+	m.update(newTestSnapshot())
+
+	routes := m.tables[0]
+	if assert.Equal(t, "/b", routes.rows[0][0].text, "Routes should be sorted by count %s", ballotX) {
+		t.Logf("Routes are sorted by count %s", checkMark)
+	}
+	m.handle(keyReverse)
+	if assert.Equal(t, "/a", routes.rows[0][0].text, "Reverse sort does not work %s", ballotX) {
+		t.Logf("Reverse sort works %s", checkMark)
+	}
+	m.handle(keyLeft)
+	if assert.Equal(t, "/a", routes.rows[0][0].text, "Sort by route does not work %s", ballotX) {
+		t.Logf("Sort by route works %s", checkMark)
+	}
+
+	m.handle(keyNextTable)
+	m.handle(keyNextTable)
+	generic := m.tables[m.focus]
+	if assert.Equal(t, "slow", generic.rows[0][1].text, "Generic should be sorted by p99 %s", ballotX) {
+		t.Logf("Generic is sorted by p99 %s", checkMark)
+	}
+	m.handle(keyDown)
+	m.handle(keyDown)
+	if assert.Equal(t, 1, generic.selected, "Selection should stay in range %s", ballotX) {
+		t.Logf("Selection stays in range %s", checkMark)
+	}
+
+	m.handle(keyNextTable)
+	routeP99 := m.tables[m.focus]
+	if assert.Len(t, routeP99.rows, 2, "Route p99 should contain the total phase of each route %s", ballotX) &&
+		assert.Equal(t, []string{"Phases", "/items", "12.000"}, []string{routeP99.rows[0][0].text, routeP99.rows[0][1].text, routeP99.rows[0][5].text},
+			"Route p99 should be sorted by p99 %s", ballotX) {
+		t.Logf("Route p99 is sorted by p99 %s", checkMark)
+	}
+	if assert.False(t, m.handle(keyQuit), "Quit should close the view %s", ballotX) {
+		t.Logf("Quit closes the view %s", checkMark)
+	}
+}
+
+func TestTopModelView(t *testing.T) {
+	m := newTopModel("localhost:9000")
+	if assert.Contains(t, m.view(80, 24), "waiting", "Empty view should wait for data %s", ballotX) {
+		t.Logf("Empty view waits for data %s", checkMark)
+	}
+
+	m.update(newTestSnapshot())
+	out := m.view(200, 40)
+	for _, expect := range []string{"requests 20.00/s", "p99 1.500ms", "5xx 10.0%", "goroutines 42", "slow"} {
+		if assert.Contains(t, out, expect, "View should contain %s %s", expect, ballotX) {
+			t.Logf("View contains %s %s", expect, checkMark)
+		}
+	}
+	if assert.NotContains(t, out, "no per-route latency data", "Route p99 should show phases %s", ballotX) {
+		t.Logf("Route p99 shows phases %s", checkMark)
+	}
+	if assert.True(t, len(strings.Split(m.view(200, 10), "\r\n")) <= 10, "View should fit the height %s", ballotX) {
+		t.Logf("View fits the height %s", checkMark)
+	}
+
+	m.update(newSnapshot(nil, errors.New("connection refused")))
+	out = m.view(200, 40)
+	if assert.Contains(t, out, "connection refused", "View should show errors %s", ballotX) &&
+		assert.Contains(t, out, "goroutines 42", "View should keep the last data %s", ballotX) {
+		t.Logf("View shows errors and keeps the last data %s", checkMark)
+	}
+}
+
+func TestTopModelViewWithoutPhases(t *testing.T) {
+	m := newTopModel("localhost:9000")
+	m.update(newSnapshot(map[string]json.RawMessage{
+		"RequestTime": mustMarshal(ginmon.RequestTimeStats{Count: 100, P99: 1500000}),
+	}, nil))
+	if assert.Contains(t, m.view(200, 40), "no per-route latency data", "Route p99 should explain missing data %s", ballotX) {
+		t.Logf("Route p99 explains missing data %s", checkMark)
+	}
+}
@@ -0,0 +1,26 @@
+package gomonitor
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// dashboardPath serves a dashboard, that charts the history of all
+// aspects. It needs no external resources.
+//
+// Example:
+//    % open http://localhost:9000/dashboard/
+const dashboardPath = "/dashboard/"
+
+//go:embed dashboard
+var dashboardAssets embed.FS
+
+// dashboardHandler serves the embedded dashboard assets.
+func dashboardHandler() http.Handler {
+	assets, err := fs.Sub(dashboardAssets, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix(dashboardPath, http.FileServer(http.FS(assets)))
+}
@@ -0,0 +1,230 @@
+// dashboard.js charts the history of the aspects served by
+// /dashboard/history. Aspects are detected by their JSON keys, like
+// the ginmon command does.
+(function () {
+  "use strict";
+
+  var colors = ["#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd",
+    "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"];
+  var svgNS = "http://www.w3.org/2000/svg";
+
+  var samples = [];
+  var maxSamples = 0;
+  var interval = 10;
+
+  function isCounter(stats) {
+    return stats && stats.request_sum_per_minute !== undefined;
+  }
+
+  function isRequestTime(stats) {
+    return stats && stats.p99 !== undefined;
+  }
+
+  function isGeneric(stats) {
+    return stats && stats.metrics !== undefined && stats.dropped !== undefined;
+  }
+
+  // series returns the values of get for all samples of the aspect
+  // name, missing values are null.
+  function series(name, get) {
+    return samples.map(function (s) {
+      var stats = s.aspects[name];
+      if (stats === undefined) {
+        return null;
+      }
+      var v = get(stats);
+      return typeof v === "number" ? v : null;
+    });
+  }
+
+  function ms(ns) {
+    return ns / 1e6;
+  }
+
+  // charts returns all charts as {title, lines: [{label, values}]}.
+  function charts() {
+    var res = [];
+    var last = samples[samples.length - 1].aspects;
+    Object.keys(last).sort().forEach(function (name) {
+      var stats = last[name];
+      if (isCounter(stats)) {
+        var codes = {};
+        samples.forEach(function (s) {
+          var c = s.aspects[name];
+          Object.keys((c && c.request_codes_per_minute) || {}).forEach(function (code) {
+            codes[code] = true;
+          });
+        });
+        res.push({
+          title: name + " requests per minute",
+          lines: [{label: "sum", values: series(name, function (c) {
+            return c.request_sum_per_minute;
+          })}].concat(Object.keys(codes).sort().map(function (code) {
+            return {label: code, values: series(name, function (c) {
+              return (c.request_codes_per_minute || {})[code] || 0;
+            })};
+          }))
+        });
+      } else if (isRequestTime(stats)) {
+        res.push({
+          title: name + " (ms)",
+          lines: ["mean", "p90", "p95", "p99", "max"].map(function (key) {
+            return {label: key, values: series(name, function (rt) {
+              return ms(rt[key]);
+            })};
+          })
+        });
+      } else if (isGeneric(stats)) {
+        var metrics = stats.metrics || {};
+        Object.keys(metrics).sort().forEach(function (key) {
+          var kind = metrics[key].kind || "distribution";
+          var keys = kind === "distribution" ? ["mean", "p99", "max"] : ["value"];
+          res.push({
+            title: name + " " + key + " (" + kind + ")",
+            lines: keys.map(function (k) {
+              return {label: k, values: series(name, function (g) {
+                var m = (g.metrics || {})[key];
+                return m && m[k];
+              })};
+            })
+          });
+        });
+        res.push({
+          title: name + " dropped values and removed names",
+          lines: ["dropped", "expired", "evicted"].map(function (key) {
+            return {label: key, values: series(name, function (g) {
+              return g[key];
+            })};
+          })
+        });
+      }
+    });
+    return res;
+  }
+
+  function el(name, attrs, parent) {
+    var e = document.createElementNS(svgNS, name);
+    Object.keys(attrs).forEach(function (k) {
+      e.setAttribute(k, attrs[k]);
+    });
+    parent.appendChild(e);
+    return e;
+  }
+
+  function format(v) {
+    if (Math.abs(v) >= 1000) {
+      return v.toFixed(0);
+    }
+    return String(Math.round(v * 1000) / 1000);
+  }
+
+  function drawChart(chart) {
+    var w = 480, h = 200, left = 50, bottom = 20;
+    var section = document.createElement("section");
+    var title = document.createElement("h2");
+    title.textContent = chart.title;
+    section.appendChild(title);
+
+    var max = 0;
+    chart.lines.forEach(function (line) {
+      line.values.forEach(function (v) {
+        if (v !== null && v > max) {
+          max = v;
+        }
+      });
+    });
+    if (max === 0) {
+      max = 1;
+    }
+    var n = Math.max(samples.length - 1, 1);
+    var x = function (i) { return left + (w - left) * i / n; };
+    var y = function (v) { return (h - bottom) * (1 - v / max); };
+
+    var svg = el("svg", {viewBox: "0 0 " + w + " " + h, preserveAspectRatio: "none"}, section);
+    el("line", {"class": "axis", x1: left, y1: h - bottom, x2: w, y2: h - bottom}, svg);
+    el("line", {"class": "axis", x1: left, y1: 0, x2: left, y2: h - bottom}, svg);
+    el("text", {x: 2, y: 10}, svg).textContent = format(max);
+    el("text", {x: 2, y: h - bottom}, svg).textContent = "0";
+    el("text", {x: left, y: h - 4}, svg).textContent =
+      new Date(samples[0].timestamp).toLocaleTimeString();
+    el("text", {x: w, y: h - 4, "text-anchor": "end"}, svg).textContent =
+      new Date(samples[samples.length - 1].timestamp).toLocaleTimeString();
+
+    var legend = document.createElement("div");
+    legend.className = "legend";
+    chart.lines.forEach(function (line, i) {
+      var color = colors[i % colors.length];
+      var d = "";
+      var move = true;
+      line.values.forEach(function (v, j) {
+        if (v === null) {
+          move = true;
+          return;
+        }
+        d += (move ? "M" : "L") + x(j).toFixed(1) + "," + y(v).toFixed(1);
+        move = false;
+      });
+      el("path", {d: d, fill: "none", stroke: color, "stroke-width": 1.5}, svg);
+
+      var last = line.values[line.values.length - 1];
+      var item = document.createElement("span");
+      var swatch = document.createElement("i");
+      swatch.style.background = color;
+      item.appendChild(swatch);
+      item.appendChild(document.createTextNode(line.label + " " + (last === null ? "-" : format(last))));
+      legend.appendChild(item);
+    });
+    section.appendChild(legend);
+    return section;
+  }
+
+  function draw() {
+    var main = document.getElementById("charts");
+    while (main.firstChild) {
+      main.removeChild(main.firstChild);
+    }
+    if (samples.length === 0) {
+      return;
+    }
+    charts().forEach(function (chart) {
+      main.appendChild(drawChart(chart));
+    });
+  }
+
+  function setStatus(text, error) {
+    var status = document.getElementById("status");
+    status.textContent = text;
+    status.className = error ? "error" : "";
+  }
+
+  function poll() {
+    var url = "history";
+    if (samples.length > 0) {
+      url += "?since=" + encodeURIComponent(samples[samples.length - 1].timestamp);
+    }
+    fetch(url).then(function (resp) {
+      if (!resp.ok) {
+        throw new Error(resp.status + " " + resp.statusText);
+      }
+      return resp.json();
+    }).then(function (res) {
+      interval = res.interval_seconds || interval;
+      if (samples.length === 0) {
+        maxSamples = res.samples.length;
+      }
+      samples = samples.concat(res.samples || []);
+      maxSamples = Math.max(maxSamples, 3600 / interval);
+      if (samples.length > maxSamples) {
+        samples = samples.slice(samples.length - maxSamples);
+      }
+      setStatus(samples.length + " samples, every " + interval + "s", false);
+      draw();
+    }).catch(function (err) {
+      setStatus("failed to load history: " + err.message, true);
+    }).then(function () {
+      setTimeout(poll, interval * 1000);
+    });
+  }
+
+  poll();
+})();
@@ -20,7 +20,7 @@ func main() {
 
 	genericAspect := ginmon.NewGenericChannelAspect("generic")
 	genericAspect.StartTimer(3 * time.Second)
-	genericCH := genericAspect.SetupGenericChannelAspect()
+	genericAspect.SetupBufferedGenericChannelAspect(1000)
 
 	asps := []aspects.Aspect{counterAspect, requestAspect, genericAspect}
 
@@ -50,8 +50,9 @@ func main() {
 
 	router.GET("/generic", func(ctx *gin.Context) {
 		for i := 0; i < 100; i++ {
-			genericCH <- ginmon.DataChannel{Name: "foo", Value: float64(i % 2)}
-			genericCH <- ginmon.DataChannel{Name: "bar", Value: float64(i % 5)}
+			// never block the request, values are dropped if the buffer is full
+			genericAspect.TryObserve(ginmon.DataChannel{Name: "foo", Value: float64(i % 2)})
+			genericAspect.TryObserve(ginmon.DataChannel{Name: "bar", Value: float64(i % 5)})
 		}
 		ctx.JSON(http.StatusOK, gin.H{
 			"GenericChannelAspect": map[string]string{
@@ -0,0 +1,539 @@
+package gomonitor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/szuecs/gin-gomonitor/aspects"
+	"gopkg.in/mcuadros/go-monitor.v1/aspects"
+)
+
+// Content types of the text formats served by the monitor endpoint,
+// if they are preferred by the Accept header of a request.
+//
+// Example:
+//    % curl -H 'Accept: application/openmetrics-text' http://localhost:9000/
+//    % curl -H 'Accept: text/plain' http://localhost:9000/RequestTime
+const (
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	PrometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// metricPrefix is the prefix of all metric names.
+const metricPrefix = "ginmon_"
+
+type format int
+
+const (
+	formatJSON format = iota
+	formatOpenMetrics
+	formatPrometheus
+)
+
+// mediaTypes are the media types of the formats, JSON is preferred if
+// the Accept header does not prefer another one.
+var mediaTypes = []struct {
+	format    format
+	mediaType string
+}{
+	{formatJSON, "application/json"},
+	{formatOpenMetrics, "application/openmetrics-text"},
+	{formatPrometheus, "text/plain"},
+}
+
+// negotiate returns the format with the highest quality in the Accept
+// header accept.
+func negotiate(accept string) format {
+	best, bestQ := formatJSON, 0.0
+	for _, m := range mediaTypes {
+		if q := quality(accept, m.mediaType); q > bestQ {
+			best, bestQ = m.format, q
+		}
+	}
+	return best
+}
+
+// quality returns the q value of the most specific media range of
+// accept, that matches mediaType, or 0 if none matches.
+func quality(accept, mediaType string) float64 {
+	typ := mediaType[:strings.IndexByte(mediaType, '/')]
+	q, specificity := 0.0, 0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		var s int
+		switch strings.ToLower(strings.TrimSpace(params[0])) {
+		case mediaType:
+			s = 3
+		case typ + "/*":
+			s = 2
+		case "*/*":
+			s = 1
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, q = s, 1
+		for _, p := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(kv[0], "q") {
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = v
+				}
+			}
+		}
+	}
+	return q
+}
+
+// expositionHandler serves the aspects as OpenMetrics or Prometheus
+// text, if the Accept header prefers it. Otherwise next serves JSON.
+// The root path exposes all aspects, other paths the aspect of that
+// name.
+type expositionHandler struct {
+	asps []aspects.Aspect
+	next http.Handler
+}
+
+func (h *expositionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// caches must not serve one format for another Accept header
+	w.Header().Add("Vary", "Accept")
+	f := negotiate(r.Header.Get("Accept"))
+	if f == formatJSON {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	c := &collector{families: make(map[string]*family)}
+	found := false
+	for _, aspect := range h.asps {
+		if name == "" || aspect.Name() == name {
+			c.collect(aspect)
+			found = true
+		}
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	var buf bytes.Buffer
+	if f == formatOpenMetrics {
+		w.Header().Set("Content-Type", OpenMetricsContentType)
+		c.writeOpenMetrics(&buf)
+	} else {
+		w.Header().Set("Content-Type", PrometheusContentType)
+		c.writePrometheus(&buf)
+	}
+	w.Write(buf.Bytes())
+}
+
+// family is a metric family of the exposition.
+type family struct {
+	name, typ, unit, help string
+	samples               []metricSample
+}
+
+// metricSample is a sample of a family, its name is the name of the
+// family and suffix.
+type metricSample struct {
+	suffix   string
+	labels   []label
+	value    float64
+	exemplar *ginmon.Exemplar
+}
+
+type label struct {
+	name, value string
+}
+
+// collector converts the stats of aspects to metric families. Known
+// types are exposed with their kind, all other numbers of the JSON
+// data are exposed as gauges. Struct fields are part of the metric
+// name, map keys are labels, except the keys of the top level, which
+// are names like the names of a GenericChannelAspect.
+type collector struct {
+	families map[string]*family
+}
+
+func (c *collector) add(name, typ, help string, s metricSample) {
+	f, ok := c.families[name]
+	if !ok {
+		f = &family{name: name, typ: typ, unit: unitOf(name), help: help}
+		c.families[name] = f
+	}
+	f.samples = append(f.samples, s)
+}
+
+func (c *collector) collect(aspect aspects.Aspect) {
+	name := metricPrefix + snakeCase(aspect.Name())
+	switch stats := aspect.GetStats().(type) {
+	case error:
+		return
+	case ginmon.RequestTimeStats:
+		d := ginmon.GenericChannelData{
+			Count:         stats.Count,
+			Sum:           stats.Sum,
+			Min:           stats.Min,
+			Max:           stats.Max,
+			P90:           stats.P90,
+			P95:           stats.P95,
+			P99:           stats.P99,
+			WindowSeconds: stats.WindowSeconds,
+			Timestamp:     stats.Timestamp,
+			Histogram:     stats.Histogram,
+			Exemplars:     stats.Exemplars,
+		}
+		// durations are measured in nanoseconds
+		c.distribution(name+"_seconds", aspect.Name(), nil, d, 1/float64(time.Second))
+	case ginmon.GenericChannelStats:
+		c.walk(reflect.ValueOf(stats.Metrics), name, aspect.Name(), "", nil, true)
+		for _, counter := range []struct {
+			name string
+			n    int
+		}{
+			{"dropped", stats.Dropped},
+			{"expired", stats.Expired},
+			{"evicted", stats.Evicted},
+		} {
+			c.generic(name+"_"+counter.name, aspect.Name()+" "+counter.name, nil, ginmon.GenericChannelData{
+				Kind:          ginmon.KindCounter.String(),
+				Value:         float64(counter.n),
+				WindowSeconds: stats.WindowSeconds,
+				Timestamp:     stats.Timestamp,
+			})
+		}
+	default:
+		c.walk(reflect.ValueOf(stats), name, aspect.Name(), "", nil, true)
+	}
+}
+
+// walk adds the numbers of v. field is the JSON name of v, it is used
+// as label name of map keys.
+func (c *collector) walk(v reflect.Value, name, help, field string, labels []label, top bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			c.walk(v.Elem(), name, help, field, labels, top)
+		}
+	case reflect.Struct:
+		switch x := v.Interface().(type) {
+		case time.Time:
+			return
+		case ginmon.GenericChannelData:
+			c.generic(name, help, labels, x)
+			return
+		}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			tag := jsonName(t.Field(i))
+			if tag == "" {
+				continue
+			}
+			c.walk(v.Field(i), name+"_"+sanitize(tag), help+" "+tag, tag, labels, false)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		labelName := sanitize(field)
+		for _, l := range labels {
+			if l.name == labelName {
+				labelName = ""
+			}
+		}
+		if labelName == "" {
+			labelName = "key"
+		}
+		for _, key := range keys {
+			k := fmt.Sprint(key.Interface())
+			if top {
+				base, tags := splitTaggedName(k)
+				c.walk(v.MapIndex(key), name+"_"+sanitize(base), help+" "+base, "", append(copyLabels(labels), tags...), false)
+				continue
+			}
+			c.walk(v.MapIndex(key), name, help, "", append(copyLabels(labels), label{labelName, k}), false)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		c.add(name, "gauge", help, metricSample{labels: labels, value: float64(v.Int())})
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		c.add(name, "gauge", help, metricSample{labels: labels, value: float64(v.Uint())})
+	case reflect.Float32, reflect.Float64:
+		c.add(name, "gauge", help, metricSample{labels: labels, value: v.Float()})
+	case reflect.Bool:
+		value := 0.0
+		if v.Bool() {
+			value = 1
+		}
+		c.add(name, "gauge", help, metricSample{labels: labels, value: value})
+	}
+}
+
+// generic adds d by its kind.
+func (c *collector) generic(name, help string, labels []label, d ginmon.GenericChannelData) {
+	switch d.Kind {
+	case ginmon.KindCounter.String():
+		name = strings.TrimSuffix(name, "_total")
+		c.add(name, "counter", help, metricSample{suffix: "_total", labels: labels, value: d.Value})
+		if created, ok := createdOf(d); ok {
+			c.add(name, "counter", help, metricSample{suffix: "_created", labels: labels, value: created})
+		}
+	case ginmon.KindGauge.String():
+		c.add(name, "gauge", help, metricSample{labels: labels, value: d.Value})
+	default:
+		c.distribution(name, help, labels, d, 1)
+	}
+}
+
+// distribution adds d as histogram, if it has a Histogram, otherwise
+// as summary, whose quantiles 0 and 1 are the min and the max. Values
+// are multiplied by scale. Exemplars are only exposed by histograms,
+// OpenMetrics does not allow them for summaries.
+func (c *collector) distribution(name, help string, labels []label, d ginmon.GenericChannelData, scale float64) {
+	if d.Histogram != nil && d.Histogram.Count > 0 {
+		c.histogram(name, help, labels, d, scale)
+		return
+	}
+	for _, q := range []struct {
+		quantile string
+		value    float64
+	}{
+		{"0", d.Min},
+		{"0.9", d.P90},
+		{"0.95", d.P95},
+		{"0.99", d.P99},
+		{"1", d.Max},
+	} {
+		c.add(name, "summary", help, metricSample{
+			labels: append(copyLabels(labels), label{"quantile", q.quantile}),
+			value:  q.value * scale,
+		})
+	}
+	c.add(name, "summary", help, metricSample{suffix: "_sum", labels: labels, value: d.Sum * scale})
+	c.add(name, "summary", help, metricSample{suffix: "_count", labels: labels, value: float64(d.Count)})
+	if created, ok := createdOf(d); ok {
+		c.add(name, "summary", help, metricSample{suffix: "_created", labels: labels, value: created})
+	}
+}
+
+// histogram adds the buckets of d.Histogram, an exemplar is attached
+// to the bucket of its value, at most one per bucket. The sum is
+// omitted with negative values, like OpenMetrics requires.
+func (c *collector) histogram(name, help string, labels []label, d ginmon.GenericChannelData, scale float64) {
+	h := d.Histogram
+	buckets := h.Buckets()
+	exemplars := make([]*ginmon.Exemplar, len(buckets))
+	for _, key := range []string{ginmon.ExemplarP90, ginmon.ExemplarP95, ginmon.ExemplarP99, ginmon.ExemplarMax} {
+		e, ok := d.Exemplars[key]
+		if !ok {
+			continue
+		}
+		i := sort.Search(len(buckets), func(i int) bool { return buckets[i].UpperBound >= e.Value })
+		if i < len(buckets) && exemplars[i] == nil {
+			e.Value *= scale
+			exemplars[i] = &e
+		}
+	}
+	for i, b := range buckets {
+		c.add(name, "histogram", help, metricSample{
+			suffix:   "_bucket",
+			labels:   append(copyLabels(labels), label{"le", formatValue(b.UpperBound * scale)}),
+			value:    float64(b.Count),
+			exemplar: exemplars[i],
+		})
+	}
+	if h.Min >= 0 {
+		c.add(name, "histogram", help, metricSample{suffix: "_sum", labels: labels, value: h.Sum * scale})
+	}
+	c.add(name, "histogram", help, metricSample{suffix: "_count", labels: labels, value: float64(h.Count)})
+	if created, ok := createdOf(d); ok {
+		c.add(name, "histogram", help, metricSample{suffix: "_created", labels: labels, value: created})
+	}
+}
+
+// createdOf returns the start of the time frame of d in seconds since
+// the epoch, counts and sums are reset for each time frame.
+func createdOf(d ginmon.GenericChannelData) (float64, bool) {
+	if d.Timestamp.IsZero() {
+		return 0, false
+	}
+	start := d.Timestamp.Add(-time.Duration(d.WindowSeconds * float64(time.Second)))
+	return float64(start.UnixNano()) / float64(time.Second), true
+}
+
+// sortedFamilies returns the families sorted by name.
+func (c *collector) sortedFamilies() []*family {
+	res := make([]*family, 0, len(c.families))
+	for _, f := range c.families {
+		res = append(res, f)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].name < res[j].name })
+	return res
+}
+
+// writeOpenMetrics writes the families as OpenMetrics 1.0.0 text.
+func (c *collector) writeOpenMetrics(w io.Writer) {
+	for _, f := range c.sortedFamilies() {
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+		if f.unit != "" {
+			fmt.Fprintf(w, "# UNIT %s %s\n", f.name, f.unit)
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, escape(f.help, true))
+		for _, s := range f.samples {
+			fmt.Fprintf(w, "%s%s%s %s", f.name, s.suffix, formatLabels(s.labels), formatValue(s.value))
+			if s.exemplar != nil {
+				fmt.Fprintf(w, " %s", s.exemplar.OpenMetrics())
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintln(w, "# EOF")
+}
+
+// writePrometheus writes the families as Prometheus text 0.0.4, which
+// has no units, created samples and exemplars.
+func (c *collector) writePrometheus(w io.Writer) {
+	for _, f := range c.sortedFamilies() {
+		name := f.name
+		if f.typ == "counter" {
+			name += "_total"
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n", name, escape(f.help, false))
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, f.typ)
+		for _, s := range f.samples {
+			if s.suffix == "_created" {
+				continue
+			}
+			fmt.Fprintf(w, "%s%s %s\n", f.name+s.suffix, formatLabels(s.labels), formatValue(s.value))
+		}
+	}
+}
+
+func formatLabels(labels []label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = l.name + `="` + escape(l.value, true) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	// timestamps and large counts are more readable without exponent
+	if a := math.Abs(v); a >= 1e-3 && a < 1e15 {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escape escapes backslashes and line feeds, and double quotes if
+// quotes is true.
+func escape(s string, quotes bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quotes {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
+
+// unitOf returns the unit of the metric name by its suffix.
+func unitOf(name string) string {
+	for _, unit := range []string{"seconds", "bytes"} {
+		if strings.HasSuffix(name, "_"+unit) {
+			return unit
+		}
+	}
+	return ""
+}
+
+// jsonName returns the name of the struct field f in JSON, or "" if
+// it is not exposed.
+func jsonName(f reflect.StructField) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+	tag := strings.Split(f.Tag.Get("json"), ",")[0]
+	if tag == "-" {
+		return ""
+	}
+	if tag == "" {
+		return snakeCase(f.Name)
+	}
+	return tag
+}
+
+// splitTaggedName splits a name like ginmon.TaggedName returns into
+// the name and its labels.
+func splitTaggedName(name string) (string, []label) {
+	i := strings.IndexByte(name, '{')
+	if i < 0 || !strings.HasSuffix(name, "}") {
+		return name, nil
+	}
+	var labels []label
+	for _, pair := range strings.Split(name[i+1:len(name)-1], `",`) {
+		kv := strings.SplitN(pair, `="`, 2)
+		if len(kv) != 2 {
+			return name, nil
+		}
+		labels = append(labels, label{sanitize(kv[0]), strings.TrimSuffix(kv[1], `"`)})
+	}
+	return name[:i], labels
+}
+
+func copyLabels(labels []label) []label {
+	return append([]label(nil), labels...)
+}
+
+// snakeCase converts names like RequestTime to request_time.
+func snakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return sanitize(b.String())
+}
+
+// sanitize replaces all characters that are not allowed in metric and
+// label names by underscores. Names are used after a prefix, such that
+// they can start with a digit.
+func sanitize(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '_' || r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return strings.Trim(b.String(), "_")
+}
@@ -0,0 +1,136 @@
+package gomonitor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szuecs/gin-gomonitor/aspects"
+	"gopkg.in/mcuadros/go-monitor.v1/aspects"
+)
+
+func Test_Negotiate(t *testing.T) {
+	for accept, expect := range map[string]format{
+		"":                             formatJSON,
+		"*/*":                          formatJSON,
+		"application/json":             formatJSON,
+		"text/html,*/*;q=0.8":          formatJSON,
+		"text/plain":                   formatPrometheus,
+		"text/plain;version=0.0.4":     formatPrometheus,
+		"application/openmetrics-text": formatOpenMetrics,
+		"application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75," +
+			"text/plain;version=0.0.4;q=0.5,*/*;q=0.1": formatOpenMetrics,
+		"application/json;q=0.5,text/plain": formatPrometheus,
+		"text/*;q=0.9,*/*;q=0.1":            formatPrometheus,
+	} {
+		got := negotiate(accept)
+		if assert.Equal(t, expect, got, "negotiate(%q) does not work, expect %v but got %v %s", accept, expect, got, ballotX) {
+			t.Logf("negotiate(%q) works, expected %v %s", accept, got, checkMark)
+		}
+	}
+}
+
+func Test_Exposition(t *testing.T) {
+	rt := ginmon.NewRequestTimeAspect()
+	rt.Count, rt.Sum, rt.Max, rt.P99 = 2, 3e9, 2e9, 2e9
+	rt.WindowSeconds, rt.Timestamp = 60, time.Unix(1700000060, 0)
+	rt.Exemplars = map[string]ginmon.Exemplar{
+		ginmon.ExemplarMax: {TraceID: "abc", Value: 2e9, Timestamp: time.Unix(1700000001, 0)},
+	}
+	rt.Histogram = ginmon.NewHistogram(ginmon.DefaultRelativeError)
+	rt.Histogram.Add(1e9)
+	rt.Histogram.Add(2e9)
+	gca := ginmon.NewGenericChannelAspect("Generic")
+	gca.Gcd = map[string]ginmon.GenericChannelData{
+		"jobs":        {Kind: "counter", Value: 1, WindowSeconds: 60, Timestamp: rt.Timestamp},
+		"queue_depth": {Kind: "gauge", Value: 3},
+		ginmon.TaggedName("items", "/items/:id", 200): {Kind: "distribution", Count: 1, Sum: 5, Max: 5,
+			Exemplars: map[string]ginmon.Exemplar{ginmon.ExemplarMax: {TraceID: "abc", Value: 5}}},
+	}
+
+	s := &Server{}
+	handler, err := s.newHandler(DefaultConfig(0), []aspects.Aspect{rt, gca})
+	if !assert.NoError(t, err) {
+		return
+	}
+	get := func(path, accept string) (*http.Response, string) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		body, _ := io.ReadAll(w.Result().Body)
+		return w.Result(), string(body)
+	}
+	resp, body := get("/", "application/openmetrics-text")
+	if assert.Equal(t, OpenMetricsContentType, resp.Header.Get("Content-Type"), "OpenMetrics Content-Type does not work %s", ballotX) {
+		t.Logf("OpenMetrics Content-Type works %s", checkMark)
+	}
+	for _, line := range []string{
+		"# TYPE ginmon_request_time_seconds histogram",
+		"# UNIT ginmon_request_time_seconds seconds",
+		"# HELP ginmon_request_time_seconds RequestTime",
+		`ginmon_request_time_seconds_bucket{le="+Inf"} 2`,
+		"ginmon_request_time_seconds_sum 3",
+		"ginmon_request_time_seconds_count 2",
+		"ginmon_request_time_seconds_created 1700000000",
+		"# TYPE ginmon_generic_items summary",
+		`ginmon_generic_items{route="/items/:id",status="200",quantile="1"} 5`,
+		"# TYPE ginmon_generic_jobs counter",
+		"ginmon_generic_jobs_total 1",
+		"ginmon_generic_jobs_created 1700000000",
+		"# TYPE ginmon_generic_queue_depth gauge",
+		"ginmon_generic_queue_depth 3",
+		`ginmon_generic_items_count{route="/items/:id",status="200"} 1`,
+		"ginmon_generic_dropped_total 0",
+	} {
+		if assert.Contains(t, body, line+"\n", "OpenMetrics does not work, %q missing %s", line, ballotX) {
+			t.Logf("OpenMetrics works, found %q %s", line, checkMark)
+		}
+	}
+	if assert.True(t, strings.HasSuffix(body, "# EOF\n"), "OpenMetrics EOF does not work %s", ballotX) {
+		t.Logf("OpenMetrics EOF works %s", checkMark)
+	}
+	var exemplars []string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.Contains(line, " # {") {
+			exemplars = append(exemplars, line)
+		}
+	}
+	if assert.Len(t, exemplars, 1, "Exemplars should only be attached to buckets %s", ballotX) &&
+		assert.True(t, strings.HasPrefix(exemplars[0], `ginmon_request_time_seconds_bucket{le="2.0`), "Exemplar bucket does not work %s", ballotX) &&
+		assert.True(t, strings.HasSuffix(exemplars[0], `} 2 # {trace_id="abc"} 2 1700000001.000`), "Exemplar does not work %s", ballotX) {
+		t.Logf("Exemplars work, found %q %s", exemplars[0], checkMark)
+	}
+
+	resp, body = get("/Generic", "text/plain")
+	if assert.Equal(t, PrometheusContentType, resp.Header.Get("Content-Type"), "Prometheus Content-Type does not work %s", ballotX) {
+		t.Logf("Prometheus Content-Type works %s", checkMark)
+	}
+	for _, line := range []string{"# TYPE ginmon_generic_jobs_total counter", "ginmon_generic_jobs_total 1"} {
+		if assert.Contains(t, body, line+"\n", "Prometheus text does not work, %q missing %s", line, ballotX) {
+			t.Logf("Prometheus text works, found %q %s", line, checkMark)
+		}
+	}
+	for _, text := range []string{"request_time", "_created", "# EOF", "# UNIT"} {
+		assert.NotContains(t, body, text, "Prometheus text should not contain %q %s", text, ballotX)
+	}
+
+	resp, _ = get("/Missing", "text/plain")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Unknown aspect should not be found %s", ballotX)
+	resp, _ = get("/Generic", "application/json")
+	if assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "JSON does not work %s", ballotX) {
+		t.Logf("JSON works %s", checkMark)
+	}
+	for _, path := range []string{"/Generic", "/Missing"} {
+		for _, accept := range []string{"application/openmetrics-text", "text/plain", "application/json"} {
+			resp, _ = get(path, accept)
+			if assert.Equal(t, "Accept", resp.Header.Get("Vary"), "Vary of %s with %q does not work %s", path, accept, ballotX) {
+				t.Logf("Vary of %s with %q works %s", path, accept, checkMark)
+			}
+		}
+	}
+}
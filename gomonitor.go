@@ -40,7 +40,13 @@
 package gomonitor
 
 import (
-	"fmt"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"time"
 
 	mon "gopkg.in/mcuadros/go-monitor.v1"
 	"gopkg.in/mcuadros/go-monitor.v1/aspects"
@@ -50,7 +56,8 @@ import (
 // https://github.com/mcuadros/go-monitor package of your
 // https://github.com/gin-gonic/gin based webapp. Start() get a
 // port number as parameter to expose monitoring data to and a slice
-// of aspects.Aspect defined by the user.
+// of aspects.Aspect defined by the user. It uses DefaultConfig, use
+// StartWithConfig to configure the endpoint or to handle errors.
 //
 // Example:
 //    	router := gin.New()
@@ -63,10 +70,178 @@ import (
 //    	// last middleware
 //    	router.Use(gin.Recovery())
 func Start(port int, asps []aspects.Aspect) {
-	var monitor *mon.Monitor = mon.NewMonitor(fmt.Sprintf(":%d", port))
+	StartWithConfig(DefaultConfig(port), asps)
+}
+
+// Config configures the monitor endpoint started by StartWithConfig.
+type Config struct {
+	// Port to expose monitoring data to on all interfaces.
+	Port int
+	// Addr like "127.0.0.1:9000" is used instead of Port if set.
+	Addr string
+	// UnixSocket is the path of a Unix domain socket, that is used
+	// instead of Addr and Port if set. A stale socket, that refuses
+	// connections, is removed.
+	UnixSocket string
+	// UnixSocketMode are the permissions of UnixSocket, 0600 if 0.
+	UnixSocketMode os.FileMode
+	// Listener is used instead of all other addresses if set.
+	Listener net.Listener
+	// HistoryInterval is the time between two samples of all aspects
+	// shown by the dashboard at /dashboard/. The dashboard is only
+	// served if it is set.
+	HistoryInterval time.Duration
+	// HistorySize is the number of samples kept for the dashboard.
+	HistorySize int
+	// Auth protects all paths of the endpoint if set, except
+	// LivenessPath and ReadinessPath.
+	Auth *Auth
+	// TLS encrypts the endpoint if set, otherwise it uses plain HTTP.
+	TLS *TLS
+	// Health serves its checks at LivenessPath, ReadinessPath and as
+	// aspect Health if set.
+	Health *Health
+}
+
+// DefaultConfig returns the Config used by Start.
+func DefaultConfig(port int) Config {
+	return Config{Port: port}
+}
+
+// Server is a running monitor endpoint.
+type Server struct {
+	listener net.Listener
+	server   *http.Server
+	history  *history
+	health   *Health
+}
+
+// StartWithConfig exposes the given aspects like Start, configured by
+// cfg. It returns after the listener was created, the endpoint is
+// served in a goroutine until Shutdown is called.
+func StartWithConfig(cfg Config, asps []aspects.Aspect) (*Server, error) {
+	s := &Server{health: cfg.Health}
+	handler, err := s.newHandler(cfg, asps)
+	if err != nil {
+		return nil, err
+	}
+	var tlsConfig *tls.Config
+	if cfg.TLS != nil {
+		if tlsConfig, err = newTLSConfig(cfg.TLS); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := listen(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	s.listener = ln
+	s.server = &http.Server{Handler: handler}
+	if s.history != nil {
+		go s.history.run()
+	}
+	go s.server.Serve(ln)
+	return s, nil
+}
+
+// newHandler returns the handler of all paths of the endpoint. The
+// aspects are served by go-monitor as JSON, or as OpenMetrics or
+// Prometheus text if the Accept header prefers it. Other paths are
+// added in front of it.
+func (s *Server) newHandler(cfg Config, asps []aspects.Aspect) (http.Handler, error) {
+	var ah *authHandler
+	if cfg.Auth != nil {
+		var err error
+		if ah, err = newAuthHandler(cfg.Auth); err != nil {
+			return nil, err
+		}
+		asps = append(asps[:len(asps):len(asps)], ah.rejected)
+	}
+	if cfg.Health != nil {
+		asps = append(asps[:len(asps):len(asps)], &healthAspect{cfg.Health})
+	}
+
+	monitor := mon.NewMonitor(cfg.address())
 	for _, aspect := range asps {
 		monitor.AddAspect(aspect)
 	}
+	monitor.AddAspect(newIndexAspect(asps))
+
+	mux := http.NewServeMux()
+	mux.Handle("/", &expositionHandler{asps: asps, next: monitor})
+	if cfg.HistoryInterval > 0 {
+		s.history = newHistory(asps, cfg.HistoryInterval, cfg.HistorySize)
+		mux.Handle(historyPath, s.history)
+		mux.Handle(dashboardPath, dashboardHandler())
+	}
+	if ah != nil {
+		// probes of the health paths do not have credentials
+		ah.next = mux
+		mux = http.NewServeMux()
+		mux.Handle("/", ah)
+	}
+	if cfg.Health != nil {
+		mux.Handle(LivenessPath, cfg.Health.handler(true))
+		mux.Handle(ReadinessPath, cfg.Health.handler(false))
+	}
+	return mux, nil
+}
+
+// Addr returns the address of the listener, which is useful if the
+// Port 0 was used to get a free port.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Shutdown stops the endpoint gracefully, see http.Server.Shutdown.
+// The readiness of Config.Health fails during the shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.health != nil {
+		s.health.SetReady(false)
+	}
+	if s.history != nil {
+		s.history.stop()
+	}
+	return s.server.Shutdown(ctx)
+}
+
+// IndexName is the name of the aspect that lists the names of all
+// aspects passed to Start, such that clients can discover them.
+//
+// Example:
+//    % curl http://localhost:9000/Aspects
+const IndexName = "Aspects"
+
+// indexAspect lists the names of aspects.
+type indexAspect struct {
+	names []string
+}
+
+func newIndexAspect(asps []aspects.Aspect) *indexAspect {
+	names := make([]string, 0, len(asps))
+	for _, aspect := range asps {
+		names = append(names, aspect.Name())
+	}
+	sort.Strings(names)
+	return &indexAspect{names: names}
+}
+
+// GetStats to fulfill aspects.Aspect interface, it returns the sorted
+// names of all aspects.
+func (ia *indexAspect) GetStats() interface{} {
+	return ia.names
+}
+
+// Name to fulfill aspects.Aspect interface.
+func (ia *indexAspect) Name() string {
+	return IndexName
+}
 
-	go monitor.Start()
+// InRoot to fulfill aspects.Aspect interface.
+func (ia *indexAspect) InRoot() bool {
+	return false
 }
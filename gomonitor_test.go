@@ -1,8 +1,136 @@
 package gomonitor
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szuecs/gin-gomonitor/aspects"
+	"gopkg.in/mcuadros/go-monitor.v1/aspects"
 )
 
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
 func Test_Start(t *testing.T) {
 }
+
+func Test_IndexAspect(t *testing.T) {
+	ia := newIndexAspect([]aspects.Aspect{
+		ginmon.NewRequestTimeAspect(),
+		ginmon.NewCounterAspect(),
+		ginmon.NewGenericChannelAspect("generic"),
+	})
+	expect := []string{"Counter", "RequestTime", "generic"}
+	if assert.Equal(t, expect, ia.GetStats(), "Index does not work, expect %v but got %v %s",
+		expect, ia.GetStats(), ballotX) {
+		t.Logf("Index works, expected %v %s", ia.GetStats(), checkMark)
+	}
+	if assert.Equal(t, IndexName, ia.Name(), "Name does not work %s", ballotX) {
+		t.Logf("Name works %s", checkMark)
+	}
+	if assert.False(t, ia.InRoot(), "InRoot does not work %s", ballotX) {
+		t.Logf("InRoot works %s", checkMark)
+	}
+}
+
+func Test_StartWithConfig(t *testing.T) {
+	cfg := DefaultConfig(0)
+	cfg.HistoryInterval = 10 * time.Millisecond
+	srv, err := StartWithConfig(cfg, []aspects.Aspect{ginmon.NewCounterAspect()})
+	if !assert.NoError(t, err, "StartWithConfig does not work %s", ballotX) {
+		return
+	}
+	defer srv.Shutdown(context.Background())
+	base := fmt.Sprintf("http://%s", srv.Addr())
+
+	for path, contentType := range map[string]string{
+		"/dashboard":              "text/html; charset=utf-8",
+		"/dashboard/dashboard.js": "text/javascript; charset=utf-8",
+		"/dashboard/history":      "application/json",
+	} {
+		resp, err := http.Get(base + path)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		resp.Body.Close()
+		if assert.Equal(t, http.StatusOK, resp.StatusCode, "%s does not work, expect %d but got %d %s",
+			path, http.StatusOK, resp.StatusCode, ballotX) {
+			t.Logf("%s works, expected %d %s", path, resp.StatusCode, checkMark)
+		}
+		if assert.Equal(t, contentType, resp.Header.Get("Content-Type"), "Content-Type of %s does not work %s",
+			path, ballotX) {
+			t.Logf("Content-Type of %s works %s", path, checkMark)
+		}
+	}
+}
+
+func Test_StartWithoutDashboard(t *testing.T) {
+	srv, err := StartWithConfig(DefaultConfig(0), []aspects.Aspect{ginmon.NewCounterAspect()})
+	if !assert.NoError(t, err, "StartWithConfig does not work %s", ballotX) {
+		return
+	}
+	defer srv.Shutdown(context.Background())
+	if assert.Nil(t, srv.history, "DefaultConfig should not sample a history %s", ballotX) {
+		t.Logf("DefaultConfig does not sample a history %s", checkMark)
+	}
+	resp, err := http.Get(fmt.Sprintf("http://%s%s", srv.Addr(), dashboardPath))
+	if !assert.NoError(t, err) {
+		return
+	}
+	resp.Body.Close()
+	if assert.NotEqual(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"), "DefaultConfig should not serve the dashboard %s", ballotX) {
+		t.Logf("DefaultConfig does not serve the dashboard %s", checkMark)
+	}
+}
+
+func Test_History(t *testing.T) {
+	counter := ginmon.NewCounterAspect()
+	h := newHistory([]aspects.Aspect{counter}, time.Second, 2)
+	start := time.Now()
+	for i := 1; i <= 3; i++ {
+		counter.RequestsSum = i
+		h.sample(start.Add(time.Duration(i) * time.Second))
+	}
+
+	var res struct {
+		IntervalSeconds float64  `json:"interval_seconds"`
+		Samples         []sample `json:"samples"`
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", historyPath, nil))
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	if assert.Len(t, res.Samples, 2, "Ring buffer does not work, expect %d samples but got %d %s",
+		2, len(res.Samples), ballotX) {
+		t.Logf("Ring buffer works, expected %d samples %s", len(res.Samples), checkMark)
+	}
+	var c ginmon.CounterAspect
+	assert.NoError(t, json.Unmarshal(res.Samples[0].Aspects["Counter"], &c))
+	if assert.Equal(t, 2, c.RequestsSum, "Oldest sample does not work, expect %d but got %d %s",
+		2, c.RequestsSum, ballotX) {
+		t.Logf("Oldest sample works, expected %d %s", c.RequestsSum, checkMark)
+	}
+	if assert.Equal(t, 1.0, res.IntervalSeconds, "Interval does not work %s", ballotX) {
+		t.Logf("Interval works %s", checkMark)
+	}
+
+	since := start.Add(2 * time.Second).Format(time.RFC3339Nano)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", historyPath+"?since="+since, nil))
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	if assert.Len(t, res.Samples, 1, "Since does not work, expect %d samples but got %d %s",
+		1, len(res.Samples), ballotX) {
+		t.Logf("Since works, expected %d samples %s", len(res.Samples), checkMark)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", historyPath+"?since=yesterday", nil))
+	if assert.Equal(t, http.StatusBadRequest, rec.Code, "Invalid since does not work %s", ballotX) {
+		t.Logf("Invalid since works %s", checkMark)
+	}
+}
@@ -0,0 +1,277 @@
+package gomonitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Paths of the health endpoints served if Config.Health is set.
+//
+// Example:
+//    % curl http://localhost:9000/healthz
+//    % curl http://localhost:9000/readyz
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// HealthName is the name of the aspect that exposes the results of
+// all checks.
+const HealthName = "Health"
+
+// DefaultCheckTimeout is used for checks without a Timeout.
+const DefaultCheckTimeout = 5 * time.Second
+
+// Status of a check or of all checks.
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFail     = "fail"
+	StatusShutdown = "shutting_down"
+)
+
+// Check is a named health check.
+type Check struct {
+	Name string
+	// Func returns an error if the check fails, it has to return when
+	// ctx is done.
+	Func func(ctx context.Context) error
+	// Timeout of Func, DefaultCheckTimeout if 0.
+	Timeout time.Duration
+	// Critical checks fail the result, other failing checks only
+	// degrade it.
+	Critical bool
+	// Liveness checks are also run by LivenessPath, all checks are run
+	// by ReadinessPath. Only use them for failures a restart can fix.
+	Liveness bool
+	// CacheInterval reuses the result of Func for the given duration,
+	// such that frequent probes do not overload dependencies.
+	CacheInterval time.Duration
+}
+
+// CheckResult is the result of one check.
+type CheckResult struct {
+	Status         string    `json:"status"`
+	Error          string    `json:"error,omitempty"`
+	Critical       bool      `json:"critical"`
+	LatencySeconds float64   `json:"latency_seconds"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// HealthResult is the result of all checks.
+type HealthResult struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Health is a registry of checks, it is safe for concurrent use.
+type Health struct {
+	mu       sync.RWMutex
+	checks   map[string]*checkState
+	shutdown int32 // accessed atomically
+}
+
+// checkState caches the last result of a check. The Mutex is held
+// while the check runs, resultLock while result is accessed.
+type checkState struct {
+	sync.Mutex
+	check      Check
+	resultLock sync.RWMutex
+	result     CheckResult
+}
+
+// NewHealth returns an empty Health registry.
+func NewHealth() *Health {
+	return &Health{checks: make(map[string]*checkState)}
+}
+
+// Register adds c, it fails if a check with the same name exists.
+func (h *Health) Register(c Check) error {
+	if c.Name == "" || c.Func == nil {
+		return fmt.Errorf("check needs a name and a func")
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultCheckTimeout
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.checks[c.Name]; ok {
+		return fmt.Errorf("check %s already registered", c.Name)
+	}
+	h.checks[c.Name] = &checkState{check: c}
+	return nil
+}
+
+// SetReady toggles the readiness. Set it to false on shutdown, such
+// that no new traffic is sent before the service stops. Server.Shutdown
+// does it, too.
+func (h *Health) SetReady(ready bool) {
+	var shutdown int32
+	if !ready {
+		shutdown = 1
+	}
+	atomic.StoreInt32(&h.shutdown, shutdown)
+}
+
+// Run runs all checks in parallel, or only liveness checks if
+// liveness is true, and returns their results.
+func (h *Health) Run(ctx context.Context, liveness bool) HealthResult {
+	states := h.states(liveness)
+	results := make([]CheckResult, len(states))
+	var wg sync.WaitGroup
+	for i, state := range states {
+		wg.Add(1)
+		go func(i int, state *checkState) {
+			defer wg.Done()
+			results[i] = state.run(ctx)
+		}(i, state)
+	}
+	wg.Wait()
+	return h.aggregate(states, results, liveness)
+}
+
+// Last returns the last results of all checks without running them,
+// checks that never ran are skipped.
+func (h *Health) Last() HealthResult {
+	var states []*checkState
+	var results []CheckResult
+	for _, state := range h.states(false) {
+		if r := state.last(); !r.Timestamp.IsZero() {
+			states = append(states, state)
+			results = append(results, r)
+		}
+	}
+	return h.aggregate(states, results, false)
+}
+
+// states returns all checks, or only liveness checks if liveness is
+// true.
+func (h *Health) states(liveness bool) []*checkState {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	states := make([]*checkState, 0, len(h.checks))
+	for _, state := range h.checks {
+		if !liveness || state.check.Liveness {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// aggregate returns the status of all results, results[i] is the
+// result of states[i].
+func (h *Health) aggregate(states []*checkState, results []CheckResult, liveness bool) HealthResult {
+	res := HealthResult{Status: StatusOK, Checks: make(map[string]CheckResult, len(states))}
+	for i, state := range states {
+		r := results[i]
+		res.Checks[state.check.Name] = r
+		if r.Status != StatusFail {
+			continue
+		}
+		if r.Critical {
+			res.Status = StatusFail
+		} else if res.Status == StatusOK {
+			res.Status = StatusDegraded
+		}
+	}
+	if !liveness && atomic.LoadInt32(&h.shutdown) == 1 {
+		res.Status = StatusShutdown
+	}
+	return res
+}
+
+// run returns the cached result or runs the check. Concurrent callers
+// wait for one run. The check is not cancelled with ctx, only by its
+// Timeout, such that an impatient caller does not cache a failure.
+func (cs *checkState) run(ctx context.Context) CheckResult {
+	cs.Lock()
+	defer cs.Unlock()
+	if last := cs.last(); !last.Timestamp.IsZero() && time.Since(last.Timestamp) < cs.check.CacheInterval {
+		return last
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cs.check.Timeout)
+	defer cancel()
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- cs.check.Func(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := CheckResult{
+		Status:         StatusOK,
+		Critical:       cs.check.Critical,
+		LatencySeconds: time.Since(start).Seconds(),
+		Timestamp:      start,
+	}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	cs.resultLock.Lock()
+	cs.result = res
+	cs.resultLock.Unlock()
+	return res
+}
+
+// last returns the cached result, it does not wait for a running
+// check.
+func (cs *checkState) last() CheckResult {
+	cs.resultLock.RLock()
+	defer cs.resultLock.RUnlock()
+	return cs.result
+}
+
+// handler serves the results of Run as JSON, the status code is 503
+// if the status is fail or shutting_down. It is served without Auth,
+// errors of the checks are only exposed by the aspect Health.
+func (h *Health) handler(liveness bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := h.Run(r.Context(), liveness)
+		for name, c := range res.Checks {
+			c.Error = ""
+			res.Checks[name] = c
+		}
+		code := http.StatusOK
+		if res.Status == StatusFail || res.Status == StatusShutdown {
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(res)
+	})
+}
+
+// healthAspect exposes the results of all checks.
+type healthAspect struct {
+	h *Health
+}
+
+// GetStats to fulfill aspects.Aspect interface, it returns the last
+// results of the checks run by LivenessPath and ReadinessPath, such
+// that reading the stats does not run any check.
+func (ha *healthAspect) GetStats() interface{} {
+	return ha.h.Last()
+}
+
+// Name to fulfill aspects.Aspect interface.
+func (ha *healthAspect) Name() string {
+	return HealthName
+}
+
+// InRoot to fulfill aspects.Aspect interface.
+func (ha *healthAspect) InRoot() bool {
+	return false
+}
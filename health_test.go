@@ -0,0 +1,165 @@
+package gomonitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Health(t *testing.T) {
+	h := NewHealth()
+	var dbErr atomic.Value
+	dbErr.Store(errors.New(""))
+	var calls, dbCalls int32
+	assert.NoError(t, h.Register(Check{
+		Name:     "db",
+		Critical: true,
+		Func: func(ctx context.Context) error {
+			atomic.AddInt32(&dbCalls, 1)
+			if err := dbErr.Load().(error); err.Error() != "" {
+				return err
+			}
+			return nil
+		},
+	}))
+	assert.NoError(t, h.Register(Check{
+		Name:          "cache",
+		Liveness:      true,
+		CacheInterval: time.Hour,
+		Func: func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return errors.New("cache is down")
+		},
+	}))
+	assert.NoError(t, h.Register(Check{
+		Name:    "slow",
+		Timeout: 10 * time.Millisecond,
+		Func: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+	if assert.Error(t, h.Register(Check{Name: "db", Func: func(context.Context) error { return nil }}),
+		"Duplicate check should fail %s", ballotX) {
+		t.Logf("Duplicate check fails %s", checkMark)
+	}
+
+	get := func(path string) (int, HealthResult) {
+		rec := httptest.NewRecorder()
+		h.handler(path == LivenessPath).ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		var res HealthResult
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		return rec.Code, res
+	}
+
+	code, res := get(ReadinessPath)
+	if assert.Equal(t, http.StatusOK, code) && assert.Equal(t, StatusDegraded, res.Status,
+		"Non critical failure does not work, expect %s but got %s %s", StatusDegraded, res.Status, ballotX) {
+		t.Logf("Non critical failure works, expected %s %s", res.Status, checkMark)
+	}
+	if assert.Equal(t, context.DeadlineExceeded.Error(), h.Last().Checks["slow"].Error, "Timeout does not work %s", ballotX) {
+		t.Logf("Timeout works %s", checkMark)
+	}
+
+	code, res = get(LivenessPath)
+	if assert.Equal(t, http.StatusOK, code) && assert.Len(t, res.Checks, 1, "Liveness should only run liveness checks %s", ballotX) {
+		t.Logf("Liveness runs only liveness checks %s", checkMark)
+	}
+	if assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "CacheInterval does not work, expect %d calls but got %d %s",
+		1, atomic.LoadInt32(&calls), ballotX) {
+		t.Logf("CacheInterval works, expected %d calls %s", atomic.LoadInt32(&calls), checkMark)
+	}
+
+	dbErr.Store(errors.New("connection refused"))
+	code, res = get(ReadinessPath)
+	if assert.Equal(t, http.StatusServiceUnavailable, code) && assert.Equal(t, StatusFail, res.Status,
+		"Critical failure does not work, expect %s but got %s %s", StatusFail, res.Status, ballotX) {
+		t.Logf("Critical failure works, expected %s %s", res.Status, checkMark)
+	}
+	if assert.Empty(t, res.Checks["db"].Error, "Errors should not be served without auth %s", ballotX) {
+		t.Logf("Errors are not served without auth %s", checkMark)
+	}
+	if stats := (&healthAspect{h}).GetStats().(HealthResult); assert.Equal(t, "connection refused", stats.Checks["db"].Error) {
+		t.Logf("Error works %s", checkMark)
+	}
+
+	dbErr.Store(errors.New(""))
+	h.SetReady(false)
+	code, res = get(ReadinessPath)
+	if assert.Equal(t, http.StatusServiceUnavailable, code) && assert.Equal(t, StatusShutdown, res.Status,
+		"Shutdown does not work, expect %s but got %s %s", StatusShutdown, res.Status, ballotX) {
+		t.Logf("Shutdown works, expected %s %s", res.Status, checkMark)
+	}
+	code, _ = get(LivenessPath)
+	if assert.Equal(t, http.StatusOK, code, "Liveness should not fail on shutdown %s", ballotX) {
+		t.Logf("Liveness does not fail on shutdown %s", checkMark)
+	}
+
+	n := atomic.LoadInt32(&dbCalls)
+	stats := (&healthAspect{h}).GetStats().(HealthResult)
+	if assert.Len(t, stats.Checks, 3, "Health aspect does not work %s", ballotX) {
+		t.Logf("Health aspect works %s", checkMark)
+	}
+	if assert.Equal(t, n, atomic.LoadInt32(&dbCalls), "Health aspect should not run checks %s", ballotX) {
+		t.Logf("Health aspect does not run checks %s", checkMark)
+	}
+	if stats := (&healthAspect{NewHealth()}).GetStats().(HealthResult); assert.Empty(t, stats.Checks,
+		"Checks that never ran should be skipped %s", ballotX) {
+		t.Logf("Checks that never ran are skipped %s", checkMark)
+	}
+}
+
+func Test_HealthCallerCancel(t *testing.T) {
+	h := NewHealth()
+	assert.NoError(t, h.Register(Check{
+		Name:          "db",
+		Liveness:      true,
+		CacheInterval: time.Hour,
+		Func: func(ctx context.Context) error {
+			select {
+			case <-time.After(30 * time.Millisecond):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	h.Run(ctx, true)
+	res := h.Run(context.Background(), true)
+	if assert.Equal(t, StatusOK, res.Status, "Cancelled caller should not fail the check, got %v %s", res, ballotX) {
+		t.Logf("Cancelled caller does not fail the check %s", checkMark)
+	}
+}
+
+func Test_HealthWithoutAuth(t *testing.T) {
+	s := &Server{}
+	cfg := DefaultConfig(0)
+	cfg.Auth = &Auth{BasicUsers: map[string]string{"monitor": "secret"}}
+	cfg.Health = NewHealth()
+	handler, err := s.newHandler(cfg, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for path, expect := range map[string]int{
+		LivenessPath:     http.StatusOK,
+		ReadinessPath:    http.StatusOK,
+		"/":              http.StatusUnauthorized,
+		"/" + HealthName: http.StatusUnauthorized,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if assert.Equal(t, expect, rec.Code, "%s without credentials does not work, expect %d but got %d %s",
+			path, expect, rec.Code, ballotX) {
+			t.Logf("%s without credentials works, expected %d %s", path, rec.Code, checkMark)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package gomonitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"gopkg.in/mcuadros/go-monitor.v1/aspects"
+)
+
+// historyPath serves the samples of all aspects taken by history.
+//
+// Example:
+//    % curl http://localhost:9000/dashboard/history
+const historyPath = dashboardPath + "history"
+
+// sample are the stats of all aspects at a point in time.
+type sample struct {
+	Timestamp time.Time                  `json:"timestamp"`
+	Aspects   map[string]json.RawMessage `json:"aspects"`
+}
+
+// history keeps the last samples of aspects in a ring buffer.
+type history struct {
+	asps     []aspects.Aspect
+	interval time.Duration
+
+	mu      sync.RWMutex
+	samples []sample
+	next    int
+	full    bool
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newHistory(asps []aspects.Aspect, interval time.Duration, size int) *history {
+	if size <= 0 {
+		size = 1
+	}
+	return &history{
+		asps:     asps,
+		interval: interval,
+		samples:  make([]sample, size),
+		done:     make(chan struct{}),
+	}
+}
+
+// run takes a sample every interval until stop is called.
+func (h *history) run() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	h.sample(time.Now())
+	for {
+		select {
+		case <-h.done:
+			return
+		case now := <-ticker.C:
+			h.sample(now)
+		}
+	}
+}
+
+func (h *history) stop() {
+	h.stopOnce.Do(func() { close(h.done) })
+}
+
+// sample marshals the stats of all aspects, such that later changes
+// of the aspects do not change the sample.
+func (h *history) sample(now time.Time) {
+	s := sample{Timestamp: now, Aspects: make(map[string]json.RawMessage, len(h.asps))}
+	for _, aspect := range h.asps {
+		raw, err := json.Marshal(aspect.GetStats())
+		if err != nil {
+			continue
+		}
+		s.Aspects[aspect.Name()] = raw
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples[h.next] = s
+	h.next = (h.next + 1) % len(h.samples)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Samples returns all samples, the oldest first.
+func (h *history) Samples() []sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if !h.full {
+		return append([]sample(nil), h.samples[:h.next]...)
+	}
+	res := make([]sample, 0, len(h.samples))
+	res = append(res, h.samples[h.next:]...)
+	return append(res, h.samples[:h.next]...)
+}
+
+// ServeHTTP returns the samples as JSON. The query parameter since
+// (RFC3339) returns only samples after the given time, which is used
+// by the dashboard to poll for new samples.
+func (h *history) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	samples := h.Samples()
+	if since := r.URL.Query().Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339Nano, since)
+		if err != nil {
+			http.Error(w, "since has to be a RFC3339 time", http.StatusBadRequest)
+			return
+		}
+		i := 0
+		for i < len(samples) && !samples[i].Timestamp.After(t) {
+			i++
+		}
+		samples = samples[i:]
+	}
+
+	res := struct {
+		IntervalSeconds float64  `json:"interval_seconds"`
+		Samples         []sample `json:"samples"`
+	}{h.interval.Seconds(), samples}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
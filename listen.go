@@ -0,0 +1,98 @@
+package gomonitor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// address returns the TCP address of cfg.
+func (cfg Config) address() string {
+	if cfg.Addr != "" {
+		return cfg.Addr
+	}
+	return fmt.Sprintf(":%d", cfg.Port)
+}
+
+// listen returns the listener configured by cfg.
+func listen(cfg Config) (net.Listener, error) {
+	if cfg.Listener != nil {
+		return cfg.Listener, nil
+	}
+	if cfg.UnixSocket == "" {
+		return net.Listen("tcp", cfg.address())
+	}
+
+	mode := cfg.UnixSocketMode
+	if mode == 0 {
+		mode = 0600
+	}
+	if err := removeStaleSocket(cfg.UnixSocket); err != nil {
+		return nil, err
+	}
+	return listenUnix(cfg.UnixSocket, mode)
+}
+
+// listenUnix creates the socket in a private directory next to path,
+// such that no client can connect before its permissions are set, and
+// links it to path afterwards. The link fails if path exists.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".gomonitor")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "s")
+	ln, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if err := os.Link(tmp, path); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return &unixListener{Listener: ln, addr: &net.UnixAddr{Name: path, Net: "unix"}}, nil
+}
+
+// unixListener removes the socket linked by listenUnix on Close.
+type unixListener struct {
+	net.Listener
+	addr *net.UnixAddr
+}
+
+func (ul *unixListener) Addr() net.Addr {
+	return ul.addr
+}
+
+func (ul *unixListener) Close() error {
+	err := ul.Listener.Close()
+	os.Remove(ul.addr.Name)
+	return err
+}
+
+// removeStaleSocket removes a socket left by a process that was
+// killed. Other files and sockets of running processes are never
+// removed, only sockets refusing connections are stale.
+func removeStaleSocket(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("unix socket %s is in use", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(path)
+}
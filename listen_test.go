@@ -0,0 +1,89 @@
+package gomonitor
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mcuadros/go-monitor.v1/aspects"
+)
+
+func Test_Listen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomonitor")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "monitor.sock")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for name, cfg := range map[string]Config{
+		"Addr":       {Addr: "127.0.0.1:0"},
+		"UnixSocket": {UnixSocket: socket, UnixSocketMode: 0660},
+		"Listener":   {Listener: ln},
+	} {
+		srv, err := StartWithConfig(cfg, []aspects.Aspect{newIndexAspect(nil)})
+		if !assert.NoError(t, err, "%s does not work %s", name, ballotX) {
+			continue
+		}
+
+		addr := srv.Addr()
+		c := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, addr.Network(), addr.String())
+			},
+		}}
+		resp, err := c.Get("http://monitor/" + IndexName)
+		if assert.NoError(t, err, "%s does not work %s", name, ballotX) {
+			resp.Body.Close()
+			t.Logf("%s works %s", name, checkMark)
+		}
+		srv.Shutdown(context.Background())
+	}
+
+	// a stale socket is replaced and gets the default permissions
+	stale, err := net.Listen("unix", socket)
+	if !assert.NoError(t, err) {
+		return
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	srv, err := StartWithConfig(Config{UnixSocket: socket}, nil)
+	if assert.NoError(t, err, "Stale socket should be removed %s", ballotX) {
+		defer srv.Shutdown(context.Background())
+		t.Logf("Stale socket is removed %s", checkMark)
+		fi, err := os.Stat(socket)
+		if assert.NoError(t, err) && assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(),
+			"UnixSocketMode does not work, expect %v but got %v %s", os.FileMode(0600), fi.Mode().Perm(), ballotX) {
+			t.Logf("UnixSocketMode works, expected %v %s", fi.Mode().Perm(), checkMark)
+		}
+	}
+
+	inUse, err := net.Listen("unix", filepath.Join(dir, "in-use.sock"))
+	if assert.NoError(t, err) {
+		defer inUse.Close()
+		_, err = StartWithConfig(Config{UnixSocket: inUse.Addr().String()}, nil)
+		if assert.Error(t, err, "Socket in use should not be removed %s", ballotX) {
+			t.Logf("Socket in use is not removed %s", checkMark)
+		}
+		_, err = net.Dial("unix", inUse.Addr().String())
+		assert.NoError(t, err, "Socket in use should still accept connections %s", ballotX)
+	}
+
+	file := filepath.Join(dir, "file")
+	assert.NoError(t, ioutil.WriteFile(file, nil, 0644))
+	_, err = StartWithConfig(Config{UnixSocket: file}, nil)
+	if assert.Error(t, err, "Other files should not be removed %s", ballotX) {
+		t.Logf("Other files are not removed %s", checkMark)
+	}
+}
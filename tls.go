@@ -0,0 +1,110 @@
+package gomonitor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLS configures the listener of the monitor endpoint to use TLS. The
+// files are read again if they were changed, such that certificates
+// can be renewed without restart.
+type TLS struct {
+	// CertFile and KeyFile are the PEM encoded certificate chain and
+	// private key of the endpoint.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile are PEM encoded CA certificates. If set, clients
+	// have to present a certificate signed by one of them (mTLS).
+	ClientCAFile string
+}
+
+// tlsReloader returns a tls.Config for each connection, with the
+// certificate and client CAs of the last readable files.
+type tlsReloader struct {
+	sync.Mutex
+	cfg     *TLS
+	modTime map[string]time.Time
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+}
+
+// newTLSConfig returns a tls.Config for cfg. It fails if the files can
+// not be read, later errors keep the files read before.
+func newTLSConfig(cfg *TLS) (*tls.Config, error) {
+	tr := &tlsReloader{cfg: cfg, modTime: make(map[string]time.Time)}
+	if err := tr.reload(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: tr.GetConfigForClient,
+	}, nil
+}
+
+// GetConfigForClient to fulfill tls.Config, it reloads changed files.
+func (tr *tlsReloader) GetConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	tr.Lock()
+	defer tr.Unlock()
+	// keep the files read before on errors, such that a half written
+	// file does not break the endpoint
+	tr.reload()
+
+	c := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*tr.cert},
+	}
+	if tr.pool != nil {
+		c.ClientCAs = tr.pool
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return c, nil
+}
+
+// reload reads the files if one of them was changed.
+func (tr *tlsReloader) reload() error {
+	files := []string{tr.cfg.CertFile, tr.cfg.KeyFile}
+	if tr.cfg.ClientCAFile != "" {
+		files = append(files, tr.cfg.ClientCAFile)
+	}
+	modTime := make(map[string]time.Time, len(files))
+	changed := false
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTime[file] = fi.ModTime()
+		if !fi.ModTime().Equal(tr.modTime[file]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(tr.cfg.CertFile, tr.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if tr.cfg.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(tr.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", tr.cfg.ClientCAFile)
+		}
+	}
+
+	tr.cert = &cert
+	tr.pool = pool
+	tr.modTime = modTime
+	return nil
+}
@@ -0,0 +1,143 @@
+package gomonitor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mcuadros/go-monitor.v1/aspects"
+)
+
+// testCert is a certificate signed by parent, or self-signed if parent
+// is nil.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, serial int64, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("gomonitor test %d", serial)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cert, err := x509.ParseCertificate(der)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write writes the PEM encoded certificate and key to dir.
+func (tc *testCert) write(t *testing.T, dir, name string, mtime time.Time) (string, string) {
+	keyDER, err := x509.MarshalECPrivateKey(tc.key)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.der}), 0644))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	assert.NoError(t, os.Chtimes(certFile, mtime, mtime))
+	assert.NoError(t, os.Chtimes(keyFile, mtime, mtime))
+	return certFile, keyFile
+}
+
+func (tc *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{tc.der}, PrivateKey: tc.key}
+}
+
+func Test_TLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomonitor")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, 1, nil, true)
+	caFile, _ := ca.write(t, dir, "ca", time.Now())
+	server := newTestCert(t, 2, ca, false)
+	certFile, keyFile := server.write(t, dir, "server", time.Now().Add(-time.Minute))
+	client := newTestCert(t, 3, ca, false)
+
+	cfg := DefaultConfig(0)
+	cfg.TLS = &TLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}
+	srv, err := StartWithConfig(cfg, []aspects.Aspect{newIndexAspect(nil)})
+	if !assert.NoError(t, err, "StartWithConfig does not work %s", ballotX) {
+		return
+	}
+	defer srv.Shutdown(context.Background())
+	url := fmt.Sprintf("https://127.0.0.1:%d/%s", srv.Addr().(*net.TCPAddr).Port, IndexName)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs ...tls.Certificate) (*http.Response, error) {
+		c := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+		resp, err := c.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	resp, err := get(client.tlsCertificate())
+	if assert.NoError(t, err, "mTLS does not work %s", ballotX) {
+		t.Logf("mTLS works %s", checkMark)
+		assert.Equal(t, big.NewInt(2), resp.TLS.PeerCertificates[0].SerialNumber)
+	}
+
+	_, err = get()
+	if assert.Error(t, err, "Request without client certificate should fail %s", ballotX) {
+		t.Logf("Request without client certificate fails %s", checkMark)
+	}
+
+	renewed := newTestCert(t, 4, ca, false)
+	renewed.write(t, dir, "server", time.Now())
+	resp, err = get(client.tlsCertificate())
+	if assert.NoError(t, err) && assert.Equal(t, big.NewInt(4), resp.TLS.PeerCertificates[0].SerialNumber,
+		"Reload does not work, expect serial %d but got %d %s", 4, resp.TLS.PeerCertificates[0].SerialNumber, ballotX) {
+		t.Logf("Reload works, expected serial %d %s", resp.TLS.PeerCertificates[0].SerialNumber, checkMark)
+	}
+
+	cfg.TLS = &TLS{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile}
+	_, err = StartWithConfig(cfg, nil)
+	if assert.Error(t, err, "Missing certificate should fail %s", ballotX) {
+		t.Logf("Missing certificate fails %s", checkMark)
+	}
+}